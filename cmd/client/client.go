@@ -3,36 +3,39 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
-	"fmt"
 	"net"
+	"time"
 
-	"github.com/Lekuruu/go-chat/internal/logging"
 	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/tcp"
 )
 
+// ClientVersion is sent to the server along with the
+// nickname, and shown to other users who look us up
+const ClientVersion = "go-chat 1.0"
+
 type ChatClient struct {
-	Host          string
-	Port          int
+	*tcp.Client
 	EncryptionKey []byte
 	Version       uint8
 	Name          string
 	Encryption    protocol.EncryptionType
 
-	Conn   net.Conn
-	Logger *logging.Logger
-	UI     *ChatUI
+	Conn net.Conn
+	UI   *ChatUI
 
-	IsAuthenticated bool
-	Challenge       []byte
+	IsAuthenticated  bool
+	Challenge        []byte
+	DisconnectReason string
 }
 
 func NewChatClient(host string, port int, key []byte) *ChatClient {
-	logger := logging.CreateLogger("client", logging.INFO)
+	// Create base client from tcp package, the chat client
+	// drives the connection itself so no handler is needed
+	tcpClient := tcp.NewClient("client", host, port, nil)
 
 	return &ChatClient{
-		Host:            host,
-		Port:            port,
-		Logger:          logger,
+		Client:          tcpClient,
 		Encryption:      protocol.EncryptionTypeNone,
 		EncryptionKey:   key,
 		Version:         1,
@@ -40,10 +43,6 @@ func NewChatClient(host string, port int, key []byte) *ChatClient {
 	}
 }
 
-func (c *ChatClient) Bind() string {
-	return net.JoinHostPort(c.Host, fmt.Sprintf("%d", c.Port))
-}
-
 func (c *ChatClient) Address() string {
 	return c.Conn.RemoteAddr().String()
 }
@@ -56,10 +55,23 @@ func (c *ChatClient) AddSystemMessage(format string, args ...interface{}) {
 	}
 }
 
-func (c *ChatClient) ShowDisconnectMessage() {
+func (c *ChatClient) AddWarningMessage(format string, args ...interface{}) {
 	if c.UI != nil {
-		c.UI.ShowDisconnectMessage("Connection lost!")
+		c.UI.AddWarningMessage(format, args...)
+	} else {
+		c.Logger.Warningf(format, args...)
+	}
+}
+
+func (c *ChatClient) ShowDisconnectMessage() {
+	if c.UI == nil {
+		return
 	}
+	if c.DisconnectReason != "" {
+		c.UI.ShowDisconnectMessage("Disconnected: " + c.DisconnectReason)
+		return
+	}
+	c.UI.ShowDisconnectMessage("Connection lost!")
 }
 
 func (c *ChatClient) ReadPacket() (*protocol.Packet, error) {
@@ -69,7 +81,15 @@ func (c *ChatClient) ReadPacket() (*protocol.Packet, error) {
 func (c *ChatClient) SendPacket(packet *protocol.Packet) error {
 	packet.Version = c.Version
 	packet.Encryption = c.Encryption
-	return packet.Serialize(c.Conn, c.EncryptionKey)
+
+	// Write the packet at once, so that message based
+	// transports like websockets receive it in one frame
+	buffer := new(bytes.Buffer)
+	if err := packet.Serialize(buffer, c.EncryptionKey); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(buffer.Bytes())
+	return err
 }
 
 func (c *ChatClient) SendChallenge() error {
@@ -96,8 +116,8 @@ func (c *ChatClient) SendChallenge() error {
 }
 
 func (c *ChatClient) SendNickname(nickname string) error {
-	nicknameString := protocol.String{Value: nickname}
-	data, err := nicknameString.ToBytes()
+	nicknameData := protocol.Nickname{Name: nickname, Client: ClientVersion}
+	data, err := nicknameData.ToBytes()
 	if err != nil {
 		return err
 	}
@@ -110,11 +130,11 @@ func (c *ChatClient) SendNickname(nickname string) error {
 	return c.SendPacket(packet)
 }
 
-func (c *ChatClient) SendMessage(content string) error {
-	message := protocol.Message{
-		Sender:  c.Name,
-		Content: content,
-	}
+// SendMessage sends a message to the chat, as a reply if the parent id
+// is set. The server acknowledges it with the message's nonce, instead
+// of sending it back to us.
+func (c *ChatClient) SendMessage(message protocol.Message) error {
+	message.Sender = c.Name
 
 	buffer := new(bytes.Buffer)
 	if err := message.Serialize(buffer); err != nil {
@@ -128,3 +148,190 @@ func (c *ChatClient) SendMessage(content string) error {
 
 	return c.SendPacket(packet)
 }
+
+// RequestHistory asks the server for messages older than the given
+// message id, or older than the given time if the id is zero
+func (c *ChatClient) RequestHistory(beforeId uint64, before time.Time) error {
+	request := protocol.HistoryRequest{
+		BeforeId:        beforeId,
+		BeforeTimestamp: before.UnixMilli(),
+		Limit:           HistoryPageSize,
+	}
+
+	data, err := request.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdHistoryRequest,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// Search asks the server for stored messages matching the query
+func (c *ChatClient) Search(query protocol.SearchQuery) error {
+	data, err := query.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdSearch,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// RequestSearchContext asks the server for the messages
+// surrounding a search result
+func (c *ChatClient) RequestSearchContext(id uint64) error {
+	messageId := protocol.MessageId{Id: id}
+
+	data, err := messageId.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdSearchContext,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// RequestThread asks the server for all replies in the
+// thread that the given message belongs to
+func (c *ChatClient) RequestThread(id uint64) error {
+	messageId := protocol.MessageId{Id: id}
+
+	data, err := messageId.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdThreadRequest,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// SendTyping tells the server whether we are typing a message
+func (c *ChatClient) SendTyping(active bool) error {
+	typing := protocol.Typing{Name: c.Name, Active: active}
+
+	data, err := typing.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdTyping,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// SetPresence tells the server whether we are online, away
+// or don't want to be disturbed, with an optional message
+func (c *ChatClient) SetPresence(state protocol.PresenceState, message string) error {
+	presence := protocol.Presence{
+		Name:    c.Name,
+		State:   state,
+		Message: message,
+	}
+
+	data, err := presence.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdPresence,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// Whois asks the server for information about a user
+func (c *ChatClient) Whois(name string) error {
+	request := protocol.String{Value: name}
+
+	data, err := request.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdWhois,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// EditMessage replaces the content of one of our messages
+func (c *ChatClient) EditMessage(id uint64, content string) error {
+	edit := protocol.MessageEdit{
+		Id:      id,
+		Content: content,
+	}
+
+	data, err := edit.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdEditMessage,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// DeleteMessage deletes one of our messages
+func (c *ChatClient) DeleteMessage(id uint64) error {
+	messageId := protocol.MessageId{Id: id}
+
+	data, err := messageId.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdDeleteMessage,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
+
+// React adds our reaction to a message, or takes it
+// back if we reacted with the same emoji before
+func (c *ChatClient) React(id uint64, emoji string) error {
+	reaction := protocol.MessageReaction{
+		Id:    id,
+		Emoji: emoji,
+	}
+
+	data, err := reaction.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdReact,
+		Data: data,
+	}
+
+	return c.SendPacket(packet)
+}
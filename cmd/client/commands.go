@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SearchResultLimit is the number of results requested per search
+const SearchResultLimit = 50
+
+// Commands are run when a message starts with a slash, and receive
+// everything after the command name as their arguments. They may
+// return a command for the UI to run afterwards.
+var Commands = make(map[string]func(m *model, args string) tea.Cmd)
+
+func init() {
+	Commands["search"] = searchCommand
+	Commands["away"] = awayCommand
+	Commands["dnd"] = doNotDisturbCommand
+	Commands["back"] = backCommand
+	Commands["whois"] = whoisCommand
+	Commands["me"] = meCommand
+}
+
+// isCommand reports whether the input is a command. Commands start
+// with a slash, which can be escaped by typing it twice.
+func isCommand(input string) bool {
+	return strings.HasPrefix(input, "/") && !strings.HasPrefix(input, "//")
+}
+
+// runCommand runs the slash command in the given input
+func (m *model) runCommand(input string) tea.Cmd {
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+
+	command, ok := Commands[strings.ToLower(name)]
+	if !ok {
+		m.addSystemMessage("Unknown command: /%s", name)
+		return nil
+	}
+	return command(m, strings.TrimSpace(args))
+}
+
+// meCommand sends an action, e.g. "/me waves"
+func meCommand(m *model, args string) tea.Cmd {
+	if args == "" {
+		m.addSystemMessage("usage: /me <action>")
+		return nil
+	}
+	return m.sendMessage(args, protocol.MessageKindAction)
+}
+
+func searchCommand(m *model, args string) tea.Cmd {
+	query, err := parseSearchQuery(args)
+	if err != nil {
+		m.addSystemMessage("%v", err)
+		return nil
+	}
+	if m.actions.Search == nil {
+		return nil
+	}
+
+	m.search = searchState{
+		open:    true,
+		loading: true,
+		query:   args,
+	}
+	m.actions.Search(query)
+	return nil
+}
+
+// parseSearchQuery reads the words to search for, along with the
+// optional "from:name", "after:YYYY-MM-DD" and "before:YYYY-MM-DD" filters
+func parseSearchQuery(args string) (protocol.SearchQuery, error) {
+	query := protocol.SearchQuery{Limit: SearchResultLimit}
+	words := make([]string, 0)
+
+	for _, field := range strings.Fields(args) {
+		key, value, found := strings.Cut(field, ":")
+		if !found || value == "" {
+			words = append(words, field)
+			continue
+		}
+
+		key = strings.ToLower(key)
+
+		switch key {
+		case "from":
+			query.Sender = value
+		case "after", "before":
+			date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+			if err != nil {
+				return query, fmt.Errorf("invalid date '%s', expected YYYY-MM-DD", value)
+			}
+			if key == "after" {
+				query.After = date.UnixMilli()
+			} else {
+				query.Before = date.UnixMilli()
+			}
+		default:
+			words = append(words, field)
+		}
+	}
+
+	if len(words) == 0 && query.Sender == "" {
+		return query, errors.New("usage: /search <words> [from:name] [after:YYYY-MM-DD] [before:YYYY-MM-DD]")
+	}
+
+	query.Text = strings.Join(words, " ")
+	return query, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+// startEditing puts our most recent message into the textarea, and
+// reports whether there was a message we are able to edit
+func (m *model) startEditing() bool {
+	if m.actions.EditMessage == nil {
+		return false
+	}
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		message := m.messages[i]
+		if message.IsSystem || message.IsDivider || message.Sender != m.name {
+			continue
+		}
+		if message.Id == 0 || message.Deleted {
+			// Messages without an id can't be referred to
+			return false
+		}
+
+		m.resetInput()
+		m.editing = message.Id
+		m.textarea.SetValue(message.Content)
+		m.textarea.Prompt = "✎ "
+		m.textarea.Placeholder = "Press Enter to delete the message, or Esc to cancel..."
+		return true
+	}
+	return false
+}
+
+// finishEditing sends the edit, or deletes the message if
+// the user removed all of its content
+func (m *model) finishEditing(content string) {
+	id := m.editing
+	original := ""
+
+	for _, message := range m.messages {
+		if message.Id == id {
+			original = message.Content
+			break
+		}
+	}
+	m.resetInput()
+
+	switch {
+	case content == "" && m.actions.DeleteMessage != nil:
+		m.actions.DeleteMessage(id)
+	case content != original:
+		m.actions.EditMessage(id, content)
+	}
+}
+
+// changeMessage applies an edit or deletion the server broadcast
+func (m *model) changeMessage(change messageChangeMsg) {
+	m.updateMessage(change.id, func(message *ChatMessage) {
+		if change.deleted {
+			message.Content = ""
+			message.Deleted = true
+			message.Reactions = nil
+			return
+		}
+		message.Content = change.content
+		message.Edited = true
+	})
+
+	if change.deleted && change.id == m.editing {
+		m.resetInput()
+	}
+	m.viewport.SetContent(m.renderMessages())
+}
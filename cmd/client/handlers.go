@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"time"
 
 	"github.com/Lekuruu/go-chat/internal/protocol"
 )
@@ -13,12 +14,25 @@ func init() {
 	AuthHandlers[protocol.PacketIdError] = handleError
 	AuthHandlers[protocol.PacketIdChallenge] = handleChallenge
 	AuthHandlers[protocol.PacketIdNicknameAck] = handleNicknameAck
+	AuthHandlers[protocol.PacketIdServerShutdown] = handleServerShutdown
 
 	MainHandlers[protocol.PacketIdError] = handleError
 	MainHandlers[protocol.PacketIdNames] = handleNames
 	MainHandlers[protocol.PacketIdJoin] = handleJoin
 	MainHandlers[protocol.PacketIdQuit] = handleQuit
 	MainHandlers[protocol.PacketIdMessage] = handleMessage
+	MainHandlers[protocol.PacketIdMessageAck] = handleMessageAck
+	MainHandlers[protocol.PacketIdEditMessage] = handleEditMessage
+	MainHandlers[protocol.PacketIdDeleteMessage] = handleDeleteMessage
+	MainHandlers[protocol.PacketIdReactions] = handleReactions
+	MainHandlers[protocol.PacketIdHistory] = handleHistory
+	MainHandlers[protocol.PacketIdSearchResults] = handleSearchResults
+	MainHandlers[protocol.PacketIdSearchContext] = handleSearchContext
+	MainHandlers[protocol.PacketIdThread] = handleThread
+	MainHandlers[protocol.PacketIdTyping] = handleTyping
+	MainHandlers[protocol.PacketIdPresence] = handlePresence
+	MainHandlers[protocol.PacketIdWhoisReply] = handleWhoisReply
+	MainHandlers[protocol.PacketIdServerShutdown] = handleServerShutdown
 }
 
 func handleError(packet *protocol.Packet, client *ChatClient) {
@@ -30,7 +44,21 @@ func handleError(packet *protocol.Packet, client *ChatClient) {
 		return
 	}
 
-	client.AddSystemMessage("Error [%d]: %s", err.Code, err.Message)
+	switch err.Code {
+	case protocol.ErrorCodeRateLimited, protocol.ErrorCodeMuted:
+		client.AddWarningMessage("%s", err.Message)
+	case protocol.ErrorCodeQueryLimit:
+		// The request we are waiting for won't be answered
+		client.AddWarningMessage("%s", err.Message)
+		if client.UI != nil {
+			client.UI.QueryFailed()
+		}
+	case protocol.ErrorCodeFlooding:
+		// The server closes the connection right after this
+		client.DisconnectReason = err.Message
+	default:
+		client.AddSystemMessage("Error [%d]: %s", err.Code, err.Message)
+	}
 }
 
 func handleChallenge(packet *protocol.Packet, client *ChatClient) {
@@ -124,5 +152,220 @@ func handleMessage(packet *protocol.Packet, client *ChatClient) {
 		return
 	}
 
-	client.UI.AddMessage(message.Sender, message.Content)
+	client.UI.AddMessage(message)
+}
+
+func handleTyping(packet *protocol.Packet, client *ChatClient) {
+	var typing protocol.Typing
+
+	if err := typing.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize typing state: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		return
+	}
+
+	client.UI.SetTyping(typing.Name, typing.Active)
+}
+
+func handlePresence(packet *protocol.Packet, client *ChatClient) {
+	var presence protocol.Presence
+
+	if err := presence.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize presence: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot update presence")
+		return
+	}
+
+	client.UI.SetPresence(presence)
+}
+
+func handleWhoisReply(packet *protocol.Packet, client *ChatClient) {
+	var info protocol.WhoisInfo
+
+	if err := info.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize whois reply: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot display user information")
+		return
+	}
+
+	client.UI.ShowWhois(info)
+}
+
+func handleEditMessage(packet *protocol.Packet, client *ChatClient) {
+	var edit protocol.MessageEdit
+
+	if err := edit.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message edit: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot edit message")
+		return
+	}
+
+	client.UI.EditMessage(edit.Id, edit.Content)
+}
+
+func handleDeleteMessage(packet *protocol.Packet, client *ChatClient) {
+	var messageId protocol.MessageId
+
+	if err := messageId.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message id: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot delete message")
+		return
+	}
+
+	client.UI.DeleteMessage(messageId.Id)
+}
+
+func handleMessageAck(packet *protocol.Packet, client *ChatClient) {
+	var ack protocol.MessageAck
+
+	if err := ack.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message acknowledgement: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot update message")
+		return
+	}
+
+	if ack.Code != 0 {
+		// The reason was sent to us as an error already
+		client.UI.FailMessage(ack.Nonce)
+		return
+	}
+	client.UI.AcknowledgeMessage(ack.Nonce, ack.Id, time.UnixMilli(ack.Timestamp))
+}
+
+func handleReactions(packet *protocol.Packet, client *ChatClient) {
+	var reactions protocol.MessageReactions
+
+	if err := reactions.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize reactions: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot update reactions")
+		return
+	}
+
+	client.UI.SetReactions(reactions.Id, reactions.Reactions)
+}
+
+func handleHistory(packet *protocol.Packet, client *ChatClient) {
+	var batch protocol.HistoryBatch
+	buffer := bytes.NewBuffer(packet.Data)
+
+	if err := batch.Deserialize(buffer); err != nil {
+		client.Logger.Errorf("Failed to deserialize history: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot display history")
+		return
+	}
+
+	client.UI.AddHistory(historyMessages(batch))
+}
+
+func handleSearchResults(packet *protocol.Packet, client *ChatClient) {
+	var batch protocol.HistoryBatch
+	buffer := bytes.NewBuffer(packet.Data)
+
+	if err := batch.Deserialize(buffer); err != nil {
+		client.Logger.Errorf("Failed to deserialize search results: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot display search results")
+		return
+	}
+
+	client.UI.ShowSearchResults(historyMessages(batch))
+}
+
+func handleSearchContext(packet *protocol.Packet, client *ChatClient) {
+	var batch protocol.HistoryBatch
+	buffer := bytes.NewBuffer(packet.Data)
+
+	if err := batch.Deserialize(buffer); err != nil {
+		client.Logger.Errorf("Failed to deserialize search context: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot display search context")
+		return
+	}
+
+	client.UI.ShowSearchContext(historyMessages(batch))
+}
+
+func handleThread(packet *protocol.Packet, client *ChatClient) {
+	var batch protocol.HistoryBatch
+	buffer := bytes.NewBuffer(packet.Data)
+
+	if err := batch.Deserialize(buffer); err != nil {
+		client.Logger.Errorf("Failed to deserialize thread: %v", err)
+		return
+	}
+
+	if client.UI == nil {
+		client.Logger.Warning("UI is not initialized, cannot display thread")
+		return
+	}
+
+	client.UI.ShowThread(historyMessages(batch))
+}
+
+func historyMessages(batch protocol.HistoryBatch) []ChatMessage {
+	messages := make([]ChatMessage, 0, len(batch.Messages))
+	for _, message := range batch.Messages {
+		messages = append(messages, ChatMessage{
+			Id:        message.Id,
+			Timestamp: time.UnixMilli(message.Timestamp),
+			Sender:    message.Sender,
+			Content:   message.Content,
+			Edited:    message.Edited,
+			Deleted:   message.Deleted,
+			Reactions: message.Reactions,
+			ParentId:  message.ParentId,
+			Kind:      message.Kind,
+		})
+	}
+	return messages
+}
+
+func handleServerShutdown(packet *protocol.Packet, client *ChatClient) {
+	var reason protocol.String
+	buffer := bytes.NewBuffer(packet.Data)
+
+	if err := reason.Deserialize(buffer); err != nil {
+		client.Logger.Errorf("Failed to deserialize shutdown reason: %v", err)
+		reason.Value = "Server is shutting down"
+	}
+
+	client.DisconnectReason = reason.Value
+	client.AddSystemMessage("Server shutting down: %s", reason.Value)
 }
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/transport"
 )
 
 func main() {
@@ -27,9 +30,35 @@ func main() {
 		fmt.Printf("Failed to read config file: %v\n", err)
 		return
 	}
+	if err := clientConfig.Validate(); err != nil {
+		fmt.Printf("Invalid config file: %v\n", err)
+		return
+	}
 
 	client := NewChatClient(clientConfig.ServerHost, clientConfig.ServerPort, clientConfig.SecretKey)
-	conn, err := net.Dial("tcp", client.Bind())
+	client.Endpoint = clientConfig.ServerAddress
+
+	if clientConfig.TLSEnabled {
+		// Verify the certificate against the host we actually dial,
+		// which is taken from server_address when it is set
+		endpoint, err := client.ResolveEndpoint()
+		if err != nil {
+			client.Logger.Errorf("Invalid server address: %v", err)
+			return
+		}
+		tlsConfig, err := transport.ClientTLSConfig(
+			endpoint.Host(),
+			clientConfig.TLSCertificate,
+			clientConfig.TLSFingerprint,
+		)
+		if err != nil {
+			client.Logger.Errorf("Failed to set up TLS: %v", err)
+			return
+		}
+		client.TLSConfig = tlsConfig
+	}
+
+	conn, err := client.Dial(context.Background())
 	if err != nil {
 		client.Logger.Errorf("Failed to connect to server: %v", err)
 		return
@@ -52,10 +81,63 @@ func main() {
 		return
 	}
 
-	client.UI = NewChatUI(func(content string) {
-		if err := client.SendMessage(content); err != nil {
-			client.Logger.Errorf("Failed to send message: %v", err)
-		}
+	client.UI = NewChatUI(client.Name, ChatActions{
+		SendMessage: func(message protocol.Message) {
+			if err := client.SendMessage(message); err != nil {
+				client.Logger.Errorf("Failed to send message: %v", err)
+				client.UI.FailMessage(message.Nonce)
+			}
+		},
+		RequestHistory: func(beforeId uint64, before time.Time) {
+			if err := client.RequestHistory(beforeId, before); err != nil {
+				client.Logger.Errorf("Failed to request history: %v", err)
+			}
+		},
+		Search: func(query protocol.SearchQuery) {
+			if err := client.Search(query); err != nil {
+				client.Logger.Errorf("Failed to search messages: %v", err)
+			}
+		},
+		RequestSearchContext: func(id uint64) {
+			if err := client.RequestSearchContext(id); err != nil {
+				client.Logger.Errorf("Failed to request search context: %v", err)
+			}
+		},
+		EditMessage: func(id uint64, content string) {
+			if err := client.EditMessage(id, content); err != nil {
+				client.Logger.Errorf("Failed to edit message: %v", err)
+			}
+		},
+		DeleteMessage: func(id uint64) {
+			if err := client.DeleteMessage(id); err != nil {
+				client.Logger.Errorf("Failed to delete message: %v", err)
+			}
+		},
+		React: func(id uint64, emoji string) {
+			if err := client.React(id, emoji); err != nil {
+				client.Logger.Errorf("Failed to send reaction: %v", err)
+			}
+		},
+		RequestThread: func(id uint64) {
+			if err := client.RequestThread(id); err != nil {
+				client.Logger.Errorf("Failed to request thread: %v", err)
+			}
+		},
+		SendTyping: func(active bool) {
+			if err := client.SendTyping(active); err != nil {
+				client.Logger.Errorf("Failed to send typing state: %v", err)
+			}
+		},
+		SetPresence: func(state protocol.PresenceState, message string) {
+			if err := client.SetPresence(state, message); err != nil {
+				client.Logger.Errorf("Failed to set presence: %v", err)
+			}
+		},
+		Whois: func(name string) {
+			if err := client.Whois(name); err != nil {
+				client.Logger.Errorf("Failed to request user information: %v", err)
+			}
+		},
 	})
 
 	// Handle all incoming packets in the background
@@ -145,5 +227,12 @@ func handlePackets(client *ChatClient) {
 		}
 
 		handler(packet, client)
+
+		if client.DisconnectReason != "" {
+			// Server told us it's going away, so
+			// we can close the connection ourselves
+			client.Conn.Close()
+			return
+		}
 	}
 }
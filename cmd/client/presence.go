@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type presenceMsg protocol.Presence
+
+var (
+	awayStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("244"))
+
+	doNotDisturbStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("160"))
+)
+
+// SetPresence updates the presence of a user in the sidebar
+func (ui *ChatUI) SetPresence(presence protocol.Presence) {
+	if ui.program != nil {
+		ui.program.Send(presenceMsg(presence))
+	}
+}
+
+func awayCommand(m *model, args string) tea.Cmd {
+	m.sendPresence(protocol.PresenceAway, args)
+	return nil
+}
+
+func doNotDisturbCommand(m *model, args string) tea.Cmd {
+	m.sendPresence(protocol.PresenceDoNotDisturb, args)
+	return nil
+}
+
+func backCommand(m *model, args string) tea.Cmd {
+	m.sendPresence(protocol.PresenceOnline, "")
+	return nil
+}
+
+func (m *model) sendPresence(state protocol.PresenceState, message string) {
+	if m.actions.SetPresence == nil {
+		return
+	}
+	m.actions.SetPresence(state, message)
+}
+
+// setPresence remembers the presence of a user, and tells
+// us when the server changed our own presence
+func (m *model) setPresence(presence protocol.Presence) {
+	previous, ok := m.presence[presence.Name]
+	if !ok {
+		previous.State = protocol.PresenceOnline
+	}
+
+	if presence.State == protocol.PresenceOnline {
+		delete(m.presence, presence.Name)
+	} else {
+		m.presence[presence.Name] = presence
+	}
+
+	if presence.Name != m.name || presence == previous {
+		return
+	}
+
+	switch presence.State {
+	case protocol.PresenceAway:
+		m.addSystemMessage("You are now away: %s", awayMessage(presence))
+	case protocol.PresenceDoNotDisturb:
+		m.addSystemMessage("Do not disturb is now on: %s", awayMessage(presence))
+	default:
+		m.addSystemMessage("You are back")
+	}
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoBottom()
+}
+
+// prunePresence forgets about users that left the chat
+func (m *model) prunePresence() {
+	for name := range m.presence {
+		if !slices.Contains(m.users, name) {
+			delete(m.presence, name)
+		}
+	}
+}
+
+func awayMessage(presence protocol.Presence) string {
+	if presence.Message == "" {
+		return "no message"
+	}
+	return presence.Message
+}
+
+// renderUser shows a user in the sidebar with a marker for their
+// presence, and the reason they are away beneath their name
+func (m model) renderUser(name string) string {
+	presence, ok := m.presence[name]
+	if !ok {
+		return "• " + name
+	}
+
+	line := lipgloss.NewStyle().MaxWidth(18)
+	var marker string
+
+	switch presence.State {
+	case protocol.PresenceDoNotDisturb:
+		marker = doNotDisturbStyle.Render("⊘ ") + name
+	default:
+		marker = awayStyle.Render("◌ " + name)
+	}
+
+	if presence.Message == "" {
+		return marker
+	}
+	message := strings.ReplaceAll(presence.Message, "\n", " ")
+	return marker + "\n" + line.Render(awayStyle.Render("  "+message))
+}
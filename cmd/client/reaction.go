@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// QuickReactions are offered when reacting to a message,
+// and are picked with the number keys
+var QuickReactions = []string{"👍", "👎", "😂", "🎉", "😮", "👀"}
+
+var reactionStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("244"))
+
+// reactable reports whether the message can be reacted to
+func reactable(message ChatMessage) bool {
+	return message.Id != 0 && !message.IsSystem && !message.IsDivider && !message.Deleted
+}
+
+// startPicking selects the most recent message, so
+// the user can move up to the one to react to
+func (m *model) startPicking() {
+	if m.actions.React == nil {
+		return
+	}
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if reactable(m.messages[i]) {
+			m.picking = true
+			m.picked = m.messages[i].Id
+			m.scrollToPicked()
+			return
+		}
+	}
+}
+
+// updatePicking handles keys while a message is being picked
+func (m model) updatePicking(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlR:
+		m.picking = false
+	case tea.KeyUp:
+		m.movePicked(-1)
+	case tea.KeyDown:
+		m.movePicked(1)
+	case tea.KeyRunes:
+		if len(msg.Runes) != 1 {
+			break
+		}
+		switch key := msg.Runes[0]; {
+		case key == 'r':
+			m.startReply(m.picked)
+			m.picking = false
+		case key == 't':
+			m.openThread(m.picked)
+			m.picking = false
+		case key >= '1' && int(key-'0') <= len(QuickReactions):
+			m.actions.React(m.picked, QuickReactions[key-'1'])
+			m.picking = false
+		}
+	}
+
+	if m.picking {
+		m.scrollToPicked()
+	} else {
+		m.viewport.SetContent(m.renderMessages())
+	}
+	return m, nil
+}
+
+// movePicked selects the next message in the given direction
+func (m *model) movePicked(direction int) {
+	current := slices.IndexFunc(m.messages, func(message ChatMessage) bool { return message.Id == m.picked })
+	if current < 0 {
+		m.picking = false
+		return
+	}
+
+	for i := current + direction; i >= 0 && i < len(m.messages); i += direction {
+		if reactable(m.messages[i]) {
+			m.picked = m.messages[i].Id
+			return
+		}
+	}
+}
+
+// scrollToPicked makes sure the picked message is visible
+func (m *model) scrollToPicked() {
+	lines, pickedLine := m.messageLines()
+	m.viewport.SetContent(strings.Join(lines, "\n"))
+
+	if pickedLine < 0 {
+		return
+	}
+	if pickedLine < m.viewport.YOffset {
+		m.viewport.SetYOffset(pickedLine)
+	} else if pickedLine >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(pickedLine - m.viewport.Height + 1)
+	}
+}
+
+// setReactions replaces the reactions of a message
+func (m *model) setReactions(update reactionsMsg) {
+	m.updateMessage(update.id, func(message *ChatMessage) {
+		message.Reactions = update.reactions
+	})
+
+	// Keep the view on the same messages, if a line was added above them
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.renderMessages())
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+// renderReactions shows the reactions beneath a message,
+// highlighting the ones we reacted with ourselves
+func (m model) renderReactions(msg ChatMessage) string {
+	parts := make([]string, 0, len(msg.Reactions))
+
+	for _, reaction := range msg.Reactions {
+		part := fmt.Sprintf("%s %d", reaction.Emoji, len(reaction.Users))
+		if slices.Contains(reaction.Users, m.name) {
+			parts = append(parts, selectedStyle.Render(part))
+			continue
+		}
+		parts = append(parts, reactionStyle.Render(part))
+	}
+
+	// Align the reactions with the sender
+	indent := strings.Repeat(" ", lipgloss.Width(formatTimestamp(msg.Timestamp))+1)
+	return indent + strings.Join(parts, "  ")
+}
+
+func (m model) renderReactionPicker() string {
+	choices := make([]string, 0, len(QuickReactions))
+	for i, emoji := range QuickReactions {
+		choices = append(choices, fmt.Sprintf("%d %s", i+1, emoji))
+	}
+
+	lines := []string{
+		"React: " + strings.Join(choices, "  "),
+		hintStyle.Render("↑/↓ select a message · r reply · t thread · Esc cancel"),
+	}
+	return lipgloss.NewStyle().Height(m.textarea.Height()).Render(strings.Join(lines, "\n"))
+}
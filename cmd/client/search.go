@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// searchState is the state of the search overlay,
+// which replaces the chat while it is open
+type searchState struct {
+	open     bool
+	loading  bool
+	query    string
+	results  []ChatMessage
+	selected int
+
+	// context holds the messages around the selected result,
+	// and is shown instead of the results while it is set
+	context     []ChatMessage
+	contextView viewport.Model
+}
+
+type searchResultsMsg []ChatMessage
+type searchContextMsg []ChatMessage
+
+var (
+	selectedStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("33"))
+
+	hintStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("244"))
+)
+
+// ShowSearchResults opens the search overlay with the given results
+func (ui *ChatUI) ShowSearchResults(messages []ChatMessage) {
+	if ui.program != nil {
+		ui.program.Send(searchResultsMsg(messages))
+	}
+}
+
+// ShowSearchContext shows the messages around the selected search result
+func (ui *ChatUI) ShowSearchContext(messages []ChatMessage) {
+	if ui.program != nil {
+		ui.program.Send(searchContextMsg(messages))
+	}
+}
+
+// updateSearch handles keys while the search overlay is open
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		if m.search.context != nil {
+			// Go back to the results
+			m.search.context = nil
+			return m, nil
+		}
+		m.search = searchState{}
+		return m, nil
+	}
+
+	if m.search.context != nil {
+		var cmd tea.Cmd
+		m.search.contextView, cmd = m.search.contextView.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.Type {
+	case tea.KeyUp:
+		m.search.selected = max(m.search.selected-1, 0)
+	case tea.KeyDown:
+		m.search.selected = min(m.search.selected+1, max(len(m.search.results)-1, 0))
+	case tea.KeyEnter:
+		if m.search.loading || len(m.search.results) == 0 || m.actions.RequestSearchContext == nil {
+			break
+		}
+		m.search.loading = true
+		m.actions.RequestSearchContext(m.search.results[m.search.selected].Id)
+	}
+	return m, nil
+}
+
+// showSearchResults replaces the shown results, unless
+// the overlay was closed before they arrived
+func (m *model) showSearchResults(results []ChatMessage) {
+	if !m.search.open {
+		return
+	}
+	m.search.loading = false
+	m.search.results = results
+	m.search.selected = 0
+	m.search.context = nil
+}
+
+// searchFailed stops waiting for a search the server refused. Without
+// any results to show, the overlay is closed to reveal the warning.
+func (m *model) searchFailed() {
+	if !m.search.open || !m.search.loading {
+		return
+	}
+	if m.search.results == nil {
+		m.search = searchState{}
+		return
+	}
+	m.search.loading = false
+}
+
+// showSearchContext shows the messages around the selected
+// result, and scrolls to the result in their middle
+func (m *model) showSearchContext(context []ChatMessage) {
+	if !m.search.open || !m.search.loading || len(m.search.results) == 0 {
+		return
+	}
+	m.search.loading = false
+
+	hitId := m.search.results[m.search.selected].Id
+	lines := make([]string, 0, len(context))
+	hitLine := 0
+
+	for _, message := range context {
+		prefix := "  "
+		if message.Id == hitId {
+			prefix = selectedStyle.Render("» ")
+			hitLine = len(lines)
+		}
+		lines = append(lines, prefix+m.renderMessage(message))
+	}
+
+	m.search.context = context
+	m.search.contextView = viewport.New(m.viewport.Width, m.viewport.Height-1)
+	m.search.contextView.SetContent(strings.Join(lines, "\n"))
+	m.search.contextView.SetYOffset(hitLine - m.search.contextView.Height/2)
+}
+
+func (m model) searchTitle() string {
+	if m.search.loading && m.search.results == nil {
+		return fmt.Sprintf("Searching for \"%s\"...", m.search.query)
+	}
+	return fmt.Sprintf("Search \"%s\" (%d)", m.search.query, len(m.search.results))
+}
+
+// renderSearch renders the overlay in place of the chat
+func (m model) renderSearch() string {
+	height := m.viewport.Height
+	width := m.viewport.Width
+	lines := make([]string, 0, height)
+
+	if m.search.context != nil {
+		lines = append(lines, hintStyle.Render("↑/↓ scroll · Esc back to results"))
+		lines = append(lines, m.search.contextView.View())
+		return lipgloss.NewStyle().Width(width).Height(height).Render(strings.Join(lines, "\n"))
+	}
+
+	lines = append(lines, hintStyle.Render("↑/↓ select · Enter show context · Esc close"))
+
+	if !m.search.loading && len(m.search.results) == 0 {
+		lines = append(lines, systemStyle.Render("* No messages found"))
+	}
+
+	// Scroll the list, so that the selected result stays visible
+	visible := max(height-1, 1)
+	start := max(0, m.search.selected-visible+1)
+	end := min(len(m.search.results), start+visible)
+	line := lipgloss.NewStyle().MaxWidth(width)
+
+	for i := start; i < end; i++ {
+		message := m.search.results[i]
+		message.Content = strings.ReplaceAll(message.Content, "\n", " ")
+
+		prefix := "  "
+		if i == m.search.selected {
+			prefix = selectedStyle.Render("› ")
+		}
+		lines = append(lines, line.Render(prefix+m.renderMessage(message)))
+	}
+
+	return lipgloss.NewStyle().Width(width).Height(height).Render(strings.Join(lines, "\n"))
+}
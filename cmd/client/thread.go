@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ReplyPreviewLength is the number of characters quoted
+// from the parent message above a reply
+const ReplyPreviewLength = 40
+
+// threadState is the state of the thread panel, which replaces
+// the chat while it is open. Anything typed in the meantime
+// is sent as a reply to the thread.
+type threadState struct {
+	open    bool
+	loading bool
+	rootId  uint64
+
+	// messages holds the message starting the
+	// thread, followed by all of its replies
+	messages []ChatMessage
+	view     viewport.Model
+}
+
+type threadMsg []ChatMessage
+
+// ShowThread fills the thread panel with the messages of a thread
+func (ui *ChatUI) ShowThread(messages []ChatMessage) {
+	if ui.program != nil {
+		ui.program.Send(threadMsg(messages))
+	}
+}
+
+// findMessage returns the message with the given id, if it is loaded
+func (m model) findMessage(id uint64) (ChatMessage, bool) {
+	for _, messages := range [][]ChatMessage{m.messages, m.thread.messages} {
+		for _, message := range messages {
+			if message.Id == id && !message.IsSystem {
+				return message, true
+			}
+		}
+	}
+	return ChatMessage{}, false
+}
+
+// threadOf returns the id of the message starting the thread
+// of the given message, since replies to replies are kept in
+// the same thread
+func (m model) threadOf(id uint64) uint64 {
+	if message, ok := m.findMessage(id); ok && message.ParentId != 0 {
+		return message.ParentId
+	}
+	return id
+}
+
+// startReply makes the next message we send a reply to the given message
+func (m *model) startReply(id uint64) {
+	if m.editing != 0 {
+		m.resetInput()
+	}
+	m.replyTo = m.threadOf(id)
+	m.textarea.Prompt = "↪ "
+	m.textarea.Placeholder = "Reply to the thread, or press Esc to cancel..."
+
+	if root, ok := m.findMessage(m.replyTo); ok {
+		m.textarea.Placeholder = fmt.Sprintf("Reply to %s, or press Esc to cancel...", root.Sender)
+	}
+}
+
+// openThread opens the panel for the thread of the given
+// message, and asks the server for its replies
+func (m *model) openThread(id uint64) {
+	if m.actions.RequestThread == nil {
+		return
+	}
+	rootId := m.threadOf(id)
+
+	m.thread = threadState{
+		open:    true,
+		loading: true,
+		rootId:  rootId,
+		view:    viewport.New(m.viewport.Width, m.viewport.Height-1),
+	}
+	m.startReply(rootId)
+	m.actions.RequestThread(rootId)
+}
+
+func (m *model) closeThread() {
+	m.thread = threadState{}
+	m.resetInput()
+	m.viewport.SetContent(m.renderMessages())
+}
+
+// updateThread handles the keys for scrolling and closing the
+// thread panel, and reports whether the key was handled. All
+// other keys are passed on to the textarea.
+func (m *model) updateThread(msg tea.KeyMsg) (bool, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.closeThread()
+		return true, nil
+	case tea.KeyCtrlR:
+		// Reacting is only possible from the chat
+		return true, nil
+	case tea.KeyUp, tea.KeyDown, tea.KeyPgUp, tea.KeyPgDown:
+		var cmd tea.Cmd
+		m.thread.view, cmd = m.thread.view.Update(msg)
+		return true, cmd
+	}
+	return false, nil
+}
+
+// showThread fills the panel, unless it was closed or
+// switched to another thread before the messages arrived
+func (m *model) showThread(messages []ChatMessage) {
+	if !m.thread.open || len(messages) == 0 || messages[0].Id != m.thread.rootId {
+		return
+	}
+	m.thread.loading = false
+	m.thread.messages = messages
+	m.thread.view.SetContent(m.renderThreadMessages())
+	m.thread.view.GotoBottom()
+}
+
+// addToThread adds a new reply to the open thread
+func (m *model) addToThread(message ChatMessage) {
+	if !m.thread.open || m.thread.loading || message.Id == 0 || message.ParentId != m.thread.rootId {
+		return
+	}
+	m.thread.messages = append(m.thread.messages, message)
+	m.thread.view.SetContent(m.renderThreadMessages())
+	m.thread.view.GotoBottom()
+}
+
+func (m model) threadTitle() string {
+	if m.thread.loading {
+		return "Loading thread..."
+	}
+	return fmt.Sprintf("Thread (%d replies)", len(m.thread.messages)-1)
+}
+
+// renderThreadMessages renders the message starting the
+// thread, with its replies indented below it
+func (m model) renderThreadMessages() string {
+	var lines []string
+
+	for i, message := range m.thread.messages {
+		prefix := ""
+		if i > 0 {
+			prefix = "  "
+		}
+		lines = append(lines, prefix+m.renderMessage(message))
+
+		if len(message.Reactions) > 0 && !message.Deleted {
+			lines = append(lines, prefix+m.renderReactions(message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderThread renders the panel in place of the chat
+func (m model) renderThread() string {
+	lines := []string{
+		hintStyle.Render("↑/↓ scroll · Enter reply · Esc close"),
+		m.thread.view.View(),
+	}
+	return lipgloss.NewStyle().
+		Width(m.viewport.Width).
+		Height(m.viewport.Height).
+		Render(strings.Join(lines, "\n"))
+}
+
+// renderReplyIndicator quotes the message starting the
+// thread, on the line above a reply
+func (m model) renderReplyIndicator(msg ChatMessage) string {
+	quote := "reply to an earlier message"
+
+	if parent, ok := m.findMessage(msg.ParentId); ok && !parent.Deleted {
+		preview := []rune(strings.ReplaceAll(parent.Content, "\n", " "))
+		if len(preview) > ReplyPreviewLength {
+			preview = append(preview[:ReplyPreviewLength], '…')
+		}
+		quote = fmt.Sprintf("%s: %s", parent.Sender, string(preview))
+	} else if ok {
+		quote = fmt.Sprintf("%s: message deleted", parent.Sender)
+	}
+
+	// Align the quote with the sender
+	indent := strings.Repeat(" ", lipgloss.Width(formatTimestamp(msg.Timestamp))+1)
+	return indent + reactionStyle.Render("↪ "+quote)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// TypingInterval is how often we tell the server
+	// that we are still typing
+	TypingInterval = 3 * time.Second
+
+	// TypingTimeout is how long someone is shown as typing,
+	// without hearing from them again
+	TypingTimeout = 6 * time.Second
+)
+
+type typingMsg struct {
+	name   string
+	active bool
+}
+
+type typingTimeoutMsg struct {
+	name string
+	at   time.Time
+}
+
+// SetTyping shows or hides that someone is typing
+func (ui *ChatUI) SetTyping(name string, active bool) {
+	if ui.program != nil {
+		ui.program.Send(typingMsg{name: name, active: active})
+	}
+}
+
+// updateTyping tells the server whether we are typing a message,
+// at most once per interval while the textarea has content
+func (m *model) updateTyping() {
+	if m.actions.SendTyping == nil || m.editing != 0 {
+		return
+	}
+
+	value := strings.TrimSpace(m.textarea.Value())
+	typing := value != "" && !isCommand(value)
+
+	switch {
+	case typing && time.Since(m.typingSent) >= TypingInterval:
+		m.typingSent = time.Now()
+		m.actions.SendTyping(true)
+	case !typing && !m.typingSent.IsZero():
+		m.typingSent = time.Time{}
+		m.actions.SendTyping(false)
+	}
+}
+
+// setTyping remembers who is typing, and returns a command
+// that hides them again once they were quiet for too long
+func (m *model) setTyping(update typingMsg) tea.Cmd {
+	if !update.active {
+		delete(m.typing, update.name)
+		return nil
+	}
+
+	now := time.Now()
+	m.typing[update.name] = now
+
+	return tea.Tick(TypingTimeout, func(time.Time) tea.Msg {
+		return typingTimeoutMsg{name: update.name, at: now}
+	})
+}
+
+// expireTyping hides the user, unless they typed again in the meantime
+func (m *model) expireTyping(timeout typingTimeoutMsg) {
+	if at, ok := m.typing[timeout.name]; ok && at.Equal(timeout.at) {
+		delete(m.typing, timeout.name)
+	}
+}
+
+// renderTyping shows who is typing, on the line above the input
+func (m model) renderTyping() string {
+	names := make([]string, 0, len(m.typing))
+	for name := range m.typing {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var text string
+	switch len(names) {
+	case 0:
+		text = ""
+	case 1:
+		text = fmt.Sprintf("%s is typing…", names[0])
+	case 2:
+		text = fmt.Sprintf("%s and %s are typing…", names[0], names[1])
+	default:
+		text = "Several people are typing…"
+	}
+
+	return systemStyle.
+		Width(m.width - 22).
+		MaxHeight(1).
+		Render(text)
+}
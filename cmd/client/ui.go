@@ -2,21 +2,78 @@ package main
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Lekuruu/go-chat/internal/protocol"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// HistoryPageSize is the number of older messages requested
+// at once, when scrolling to the top of the chat
+const HistoryPageSize = 50
+
+// DeliveryTimeout is how long we wait for the server to
+// acknowledge a message, before it is shown as failed
+const DeliveryTimeout = 10 * time.Second
+
+// ChatActions are called by the UI to send requests to the server
+type ChatActions struct {
+	SendMessage          func(message protocol.Message)
+	RequestHistory       func(beforeId uint64, before time.Time)
+	Search               func(query protocol.SearchQuery)
+	RequestSearchContext func(id uint64)
+	EditMessage          func(id uint64, content string)
+	DeleteMessage        func(id uint64)
+	React                func(id uint64, emoji string)
+	RequestThread        func(id uint64)
+	SendTyping           func(active bool)
+	SetPresence          func(state protocol.PresenceState, message string)
+	Whois                func(name string)
+}
+
+// DeliveryState tracks messages we sent ourselves,
+// until the server acknowledged them
+type DeliveryState int
+
+const (
+	DeliveryNone DeliveryState = iota
+	DeliveryPending
+	DeliverySent
+	DeliveryFailed
+)
+
 type ChatMessage struct {
+	Id        uint64
 	Timestamp time.Time
 	Sender    string
 	Content   string
 	IsSystem  bool
+	IsWarning bool
+	Edited    bool
+	Deleted   bool
+	Reactions []protocol.Reaction
+	Kind      protocol.MessageKind
+
+	// IsDivider marks the end of the history, which
+	// was sent by the server when we joined
+	IsDivider bool
+
+	// Nonce identifies our own messages in acknowledgements
+	Nonce    uint64
+	Delivery DeliveryState
+
+	// ParentId is the message starting the thread this replies to
+	ParentId uint64
+
+	// Whois is set for the information about a user, which we
+	// requested with the whois command
+	Whois *protocol.WhoisInfo
 }
 
 type ChatUI struct {
@@ -35,14 +92,67 @@ type model struct {
 	ready         bool
 	width         int
 	height        int
-	sendMessage   func(string)
+	actions       ChatActions
 	disconnected  bool
 	disconnectMsg string
+
+	// name is our own nickname, which we show for our messages
+	// before the server acknowledged them
+	name      string
+	nextNonce uint64
+
+	// editing is the id of the message we are editing, and
+	// replyTo the id of the thread we are replying to, if any
+	editing uint64
+	replyTo uint64
+
+	// picking is set while the user selects a message to react
+	// to, and picked is the id of the selected message
+	picking bool
+	picked  uint64
+
+	// loadingHistory is set while we wait for an older page,
+	// and historyComplete once the server has no more messages
+	loadingHistory  bool
+	historyComplete bool
+
+	search searchState
+	thread threadState
+
+	// typing holds the users that are typing, along with the time
+	// we last heard from them, and typingSent is when we last told
+	// the server that we are typing ourselves
+	typing     map[string]time.Time
+	typingSent time.Time
+
+	// presence holds the users who aren't simply online
+	presence map[string]protocol.Presence
 }
 
 type newMessageMsg ChatMessage
+type historyMsg []ChatMessage
 type usersUpdateMsg []string
 type disconnectMsg string
+type ackTimeoutMsg uint64
+type queryFailedMsg struct{}
+
+type reactionsMsg struct {
+	id        uint64
+	reactions []protocol.Reaction
+}
+
+type messageChangeMsg struct {
+	id      uint64
+	content string
+	deleted bool
+}
+
+type deliveryMsg struct {
+	nonce     uint64
+	id        uint64
+	timestamp time.Time
+	state     DeliveryState
+}
 
 var (
 	headerStyle = lipgloss.NewStyle().
@@ -63,6 +173,22 @@ var (
 			Italic(true).
 			Foreground(lipgloss.Color("244"))
 
+	warningStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("202"))
+
+	actionStyle = lipgloss.NewStyle().
+			Italic(true).
+			Foreground(lipgloss.Color("30"))
+
+	noticeStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("99"))
+
+	dividerStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("33")).
+			Align(lipgloss.Center)
+
 	timestampStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("244"))
 
@@ -87,16 +213,19 @@ var (
 			Padding(1)
 )
 
-func NewChatUI(sendMessage func(string)) *ChatUI {
+func NewChatUI(name string, actions ChatActions) *ChatUI {
 	ui := &ChatUI{
 		messages: make([]ChatMessage, 0),
 		users:    make([]string, 0),
 	}
 
 	m := model{
-		messages:    make([]ChatMessage, 0),
-		users:       make([]string, 0),
-		sendMessage: sendMessage,
+		messages: make([]ChatMessage, 0),
+		users:    make([]string, 0),
+		actions:  actions,
+		name:     name,
+		typing:   make(map[string]time.Time),
+		presence: make(map[string]protocol.Presence),
 	}
 
 	m.textarea = textarea.New()
@@ -132,17 +261,20 @@ func (ui *ChatUI) ShowDisconnectMessage(message string) {
 	}
 }
 
-func (ui *ChatUI) AddMessage(sender, content string) {
+func (ui *ChatUI) AddMessage(message protocol.Message) {
 	ui.mu.Lock()
 	if ui.quitting {
 		ui.mu.Unlock()
 		return
 	}
 	msg := ChatMessage{
+		Id:        message.Id,
 		Timestamp: time.Now(),
-		Sender:    sender,
-		Content:   content,
+		Sender:    message.Sender,
+		Content:   message.Content,
 		IsSystem:  false,
+		ParentId:  message.ParentId,
+		Kind:      message.Kind,
 	}
 	ui.messages = append(ui.messages, msg)
 	ui.mu.Unlock()
@@ -171,6 +303,89 @@ func (ui *ChatUI) AddSystemMessage(format string, args ...interface{}) {
 	}
 }
 
+// AddWarningMessage shows a highlighted system message, e.g. when
+// the server asks us to slow down
+func (ui *ChatUI) AddWarningMessage(format string, args ...interface{}) {
+	ui.mu.Lock()
+	if ui.quitting {
+		ui.mu.Unlock()
+		return
+	}
+	msg := ChatMessage{
+		Timestamp: time.Now(),
+		Content:   fmt.Sprintf(format, args...),
+		IsSystem:  true,
+		IsWarning: true,
+	}
+	ui.messages = append(ui.messages, msg)
+	ui.mu.Unlock()
+
+	if ui.program != nil {
+		ui.program.Send(newMessageMsg(msg))
+	}
+}
+
+// AddHistory shows messages that were sent before we joined, above
+// the messages we received ourselves. It is also used for older
+// pages, which the UI requests when scrolling to the top.
+func (ui *ChatUI) AddHistory(messages []ChatMessage) {
+	ui.mu.Lock()
+	if ui.quitting {
+		ui.mu.Unlock()
+		return
+	}
+	ui.messages = insertHistory(ui.messages, messages)
+	ui.mu.Unlock()
+
+	if ui.program != nil {
+		ui.program.Send(historyMsg(messages))
+	}
+}
+
+// QueryFailed stops waiting for an answer from the history, after
+// the server refused the request, so that it can be sent again
+func (ui *ChatUI) QueryFailed() {
+	if ui.program != nil {
+		ui.program.Send(queryFailedMsg{})
+	}
+}
+
+// AcknowledgeMessage marks one of our messages as delivered, and
+// replaces its local timestamp with the one of the server
+func (ui *ChatUI) AcknowledgeMessage(nonce uint64, id uint64, timestamp time.Time) {
+	if ui.program != nil {
+		ui.program.Send(deliveryMsg{nonce: nonce, id: id, timestamp: timestamp, state: DeliverySent})
+	}
+}
+
+// FailMessage marks one of our messages as rejected by the server
+func (ui *ChatUI) FailMessage(nonce uint64) {
+	if ui.program != nil {
+		ui.program.Send(deliveryMsg{nonce: nonce, state: DeliveryFailed})
+	}
+}
+
+// EditMessage replaces the content of a message, after it was edited
+func (ui *ChatUI) EditMessage(id uint64, content string) {
+	if ui.program != nil {
+		ui.program.Send(messageChangeMsg{id: id, content: content})
+	}
+}
+
+// DeleteMessage replaces a message with a tombstone
+func (ui *ChatUI) DeleteMessage(id uint64) {
+	if ui.program != nil {
+		ui.program.Send(messageChangeMsg{id: id, deleted: true})
+	}
+}
+
+// SetReactions replaces the reactions shown beneath a message
+func (ui *ChatUI) SetReactions(id uint64, reactions []protocol.Reaction) {
+	if ui.program != nil {
+		ui.program.Send(reactionsMsg{id: id, reactions: reactions})
+	}
+}
+
 func (ui *ChatUI) SetUsers(users []string) {
 	ui.mu.Lock()
 	if ui.quitting {
@@ -237,19 +452,55 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
+		if m.search.open {
+			return m.updateSearch(msg)
+		}
+		if m.thread.open {
+			if handled, cmd := m.updateThread(msg); handled {
+				return m, cmd
+			}
+		}
+		if m.picking {
+			return m.updatePicking(msg)
+		}
+
 		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc:
+		case tea.KeyEsc:
+			if m.editing != 0 || m.replyTo != 0 {
+				m.resetInput()
+				return m, nil
+			}
+			// Exit the program
+			return m, tea.Quit
+		case tea.KeyCtrlC:
 			// Exit the program
 			return m, tea.Quit
+		case tea.KeyCtrlR:
+			m.startPicking()
+			return m, nil
+		case tea.KeyUp:
+			// Up in an empty textarea edits our last message
+			if m.textarea.Value() == "" && m.editing == 0 && m.startEditing() {
+				return m, nil
+			}
 		case tea.KeyEnter:
 			// We want to send a message now
 			// -> grab the content and clear the textarea
 			content := strings.TrimSpace(m.textarea.Value())
-			if content != "" && m.sendMessage != nil {
-				m.sendMessage(content)
+			if m.editing != 0 {
+				m.finishEditing(content)
+				return m, nil
+			}
+			if content == "" {
+				return m, nil
+			}
+
+			if isCommand(content) {
 				m.textarea.Reset()
+				return m, m.runCommand(content)
 			}
-			return m, nil
+			content = strings.TrimPrefix(content, "/")
+			return m, m.sendMessage(content, protocol.MessageKindNormal)
 		}
 
 	case tea.WindowSizeMsg:
@@ -258,14 +509,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 
 		if !m.ready {
-			m.viewport = viewport.New(msg.Width-22, msg.Height-6)
+			m.viewport = viewport.New(msg.Width-22, msg.Height-7)
 			m.viewport.YPosition = 2
 			m.ready = true
 		} else {
 			m.viewport.Width = msg.Width - 22
-			m.viewport.Height = msg.Height - 6
+			m.viewport.Height = msg.Height - 7
 		}
 
+		m.search.contextView.Width = m.viewport.Width
+		m.search.contextView.Height = m.viewport.Height - 1
+		m.thread.view.Width = m.viewport.Width
+		m.thread.view.Height = m.viewport.Height - 1
+
 		m.textarea.SetWidth(msg.Width - 22)
 		m.viewport.SetContent(m.renderMessages())
 
@@ -273,9 +529,68 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.messages = append(m.messages, ChatMessage(msg))
 		m.viewport.SetContent(m.renderMessages())
 		m.viewport.GotoBottom()
+		m.addToThread(ChatMessage(msg))
+		delete(m.typing, msg.Sender)
+
+	case queryFailedMsg:
+		m.loadingHistory = false
+		m.searchFailed()
+		if m.thread.loading {
+			m.closeThread()
+		}
+
+	case historyMsg:
+		m.messages = insertHistory(m.messages, []ChatMessage(msg))
+
+		if !m.loadingHistory {
+			// The replay we received when joining
+			m.viewport.SetContent(m.renderMessages())
+			m.viewport.GotoBottom()
+			break
+		}
+
+		m.loadingHistory = false
+		m.historyComplete = len(msg) < HistoryPageSize
+
+		// Keep the view on the same messages, now that
+		// the older ones were added above them
+		previousLines := m.viewport.TotalLineCount()
+		m.viewport.SetContent(m.renderMessages())
+		m.viewport.SetYOffset(m.viewport.YOffset + m.viewport.TotalLineCount() - previousLines)
+
+	case deliveryMsg:
+		m.updateDelivery(msg)
+
+	case ackTimeoutMsg:
+		m.updateDelivery(deliveryMsg{nonce: uint64(msg), state: DeliveryFailed})
+
+	case messageChangeMsg:
+		m.changeMessage(msg)
+
+	case reactionsMsg:
+		m.setReactions(msg)
+
+	case typingMsg:
+		cmds = append(cmds, m.setTyping(msg))
+
+	case typingTimeoutMsg:
+		m.expireTyping(msg)
+
+	case threadMsg:
+		m.showThread([]ChatMessage(msg))
+
+	case searchResultsMsg:
+		m.showSearchResults([]ChatMessage(msg))
+
+	case searchContextMsg:
+		m.showSearchContext([]ChatMessage(msg))
 
 	case usersUpdateMsg:
 		m.users = []string(msg)
+		m.prunePresence()
+
+	case presenceMsg:
+		m.setPresence(protocol.Presence(msg))
 
 	case disconnectMsg:
 		m.disconnected = true
@@ -286,11 +601,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if !m.disconnected {
 		m.textarea, cmd = m.textarea.Update(msg)
 		cmds = append(cmds, cmd)
+
+		if _, ok := msg.(tea.KeyMsg); ok {
+			m.updateTyping()
+		}
 	}
 
 	m.viewport, cmd = m.viewport.Update(msg)
 	cmds = append(cmds, cmd)
 
+	switch msg.(type) {
+	case tea.KeyMsg, tea.MouseMsg:
+		// Load older messages once the user scrolled to the top
+		if m.viewport.AtTop() {
+			m.requestHistory()
+		}
+	}
+
 	return m, tea.Batch(cmds...)
 }
 
@@ -299,10 +626,19 @@ func (m model) View() string {
 		return "Loading..."
 	}
 
-	header := headerStyle.Width(m.width - 22).Render("go-chat")
-	userListHeader := headerStyle.Width(20).Render(fmt.Sprintf("Users (%d)", len(m.users)))
-
+	title := "go-chat"
 	chatArea := m.viewport.View()
+
+	if m.search.open {
+		title = m.searchTitle()
+		chatArea = m.renderSearch()
+	} else if m.thread.open {
+		title = m.threadTitle()
+		chatArea = m.renderThread()
+	}
+
+	header := headerStyle.Width(m.width - 22).Render(title)
+	userListHeader := headerStyle.Width(20).Render(fmt.Sprintf("Users (%d)", len(m.users)))
 	userList := m.renderUserList()
 
 	mainContent := lipgloss.JoinHorizontal(
@@ -315,6 +651,8 @@ func (m model) View() string {
 	if m.disconnected {
 		message := m.disconnectMsg + "\nPress Enter to exit..."
 		input = disconnectStyle.Width(m.width - 22).Render(message)
+	} else if m.picking {
+		input = inputStyle.Width(m.width - 22).Render(m.renderReactionPicker())
 	} else {
 		input = inputStyle.Width(m.width - 22).Render(m.textarea.View())
 	}
@@ -325,33 +663,262 @@ func (m model) View() string {
 		lipgloss.Left,
 		fullHeader,
 		mainContent,
+		m.renderTyping(),
 		input,
 	)
 }
 
 func (m model) renderMessages() string {
+	lines, _ := m.messageLines()
+	return strings.Join(lines, "\n")
+}
+
+// messageLines renders all messages along with their reactions,
+// and returns the line of the message picked for a reaction
+func (m model) messageLines() ([]string, int) {
 	var lines []string
+	pickedLine := -1
 
 	for _, msg := range m.messages {
-		timestamp := timestampStyle.Render(msg.Timestamp.Format("15:04:05"))
-
-		if msg.IsSystem {
-			line := fmt.Sprintf("%s %s",
-				timestamp,
-				systemStyle.Render("* "+msg.Content),
-			)
-			lines = append(lines, line)
-		} else {
-			line := fmt.Sprintf("%s %s %s",
-				timestamp,
-				senderStyle.Render(msg.Sender+":"),
-				messageStyle.Render(msg.Content),
-			)
-			lines = append(lines, line)
+		if msg.ParentId != 0 && !msg.Deleted {
+			lines = append(lines, m.renderReplyIndicator(msg))
+		}
+		line := m.renderMessage(msg)
+
+		if m.picking && msg.Id != 0 && msg.Id == m.picked {
+			pickedLine = len(lines)
+			line = selectedStyle.Render("› ") + line
+		}
+		lines = append(lines, line)
+
+		if len(msg.Reactions) > 0 && !msg.Deleted {
+			lines = append(lines, m.renderReactions(msg))
 		}
 	}
 
-	return strings.Join(lines, "\n")
+	return lines, pickedLine
+}
+
+func (m model) renderMessage(msg ChatMessage) string {
+	timestamp := timestampStyle.Render(formatTimestamp(msg.Timestamp))
+
+	if msg.Whois != nil {
+		return renderWhois(msg.Whois)
+	}
+
+	if msg.IsDivider {
+		return dividerStyle.
+			Width(m.viewport.Width).
+			Render("── new messages ──")
+	} else if msg.IsWarning {
+		return fmt.Sprintf("%s %s",
+			timestamp,
+			warningStyle.Render("! "+msg.Content),
+		)
+	} else if msg.IsSystem || msg.Kind == protocol.MessageKindSystem {
+		return fmt.Sprintf("%s %s",
+			timestamp,
+			systemStyle.Render("* "+msg.Content),
+		)
+	} else if msg.Kind == protocol.MessageKindNotice {
+		return fmt.Sprintf("%s %s",
+			timestamp,
+			noticeStyle.Render(fmt.Sprintf("-%s- %s", msg.Sender, msg.Content)),
+		)
+	} else if msg.Deleted {
+		return fmt.Sprintf("%s %s %s",
+			timestamp,
+			senderStyle.Render(msg.Sender+":"),
+			systemStyle.Render("message deleted"),
+		)
+	}
+
+	var edited string
+	if msg.Edited {
+		edited = timestampStyle.Render(" (edited)")
+	}
+
+	if msg.Kind == protocol.MessageKindAction {
+		// Actions read as a sentence, e.g. "* alice waves"
+		return fmt.Sprintf("%s %s%s%s",
+			timestamp,
+			actionStyle.Render(fmt.Sprintf("* %s %s", msg.Sender, msg.Content)),
+			edited,
+			renderDelivery(msg.Delivery),
+		)
+	}
+
+	return fmt.Sprintf("%s %s %s%s%s",
+		timestamp,
+		senderStyle.Render(msg.Sender+":"),
+		messageStyle.Render(msg.Content),
+		edited,
+		renderDelivery(msg.Delivery),
+	)
+}
+
+func renderDelivery(state DeliveryState) string {
+	switch state {
+	case DeliveryPending:
+		return timestampStyle.Render(" …")
+	case DeliverySent:
+		return timestampStyle.Render(" ✓")
+	case DeliveryFailed:
+		return warningStyle.Render(" ✗ not sent")
+	}
+	return ""
+}
+
+// sendMessage shows the message right away, until the server tells
+// us whether it was delivered, and returns a command that marks it
+// as failed if the server doesn't answer in time
+func (m *model) sendMessage(content string, kind protocol.MessageKind) tea.Cmd {
+	if m.actions.SendMessage == nil {
+		return nil
+	}
+	parentId := m.replyTo
+	m.resetInput()
+
+	m.nextNonce++
+	nonce := m.nextNonce
+
+	m.messages = append(m.messages, ChatMessage{
+		Timestamp: time.Now(),
+		Sender:    m.name,
+		Content:   content,
+		Kind:      kind,
+		Nonce:     nonce,
+		Delivery:  DeliveryPending,
+		ParentId:  parentId,
+	})
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoBottom()
+
+	m.actions.SendMessage(protocol.Message{
+		Content:  content,
+		Nonce:    nonce,
+		ParentId: parentId,
+		Kind:     kind,
+	})
+
+	// Others stop showing us as typing once the message
+	// arrives, so we tell them again as soon as we type
+	m.typingSent = time.Time{}
+
+	return tea.Tick(DeliveryTimeout, func(time.Time) tea.Msg {
+		return ackTimeoutMsg(nonce)
+	})
+}
+
+// resetInput clears the textarea, and stops editing or replying.
+// While a thread is open, we keep replying to it.
+func (m *model) resetInput() {
+	m.editing = 0
+	m.replyTo = 0
+	m.textarea.Reset()
+	m.textarea.Prompt = "> "
+	m.textarea.Placeholder = "Type a message..."
+
+	if m.thread.open {
+		m.startReply(m.thread.rootId)
+	}
+}
+
+// updateMessage applies a change to the message with the
+// given id, both in the chat and in the open thread
+func (m *model) updateMessage(id uint64, change func(*ChatMessage)) {
+	for _, messages := range [][]ChatMessage{m.messages, m.thread.messages} {
+		for i := range messages {
+			if messages[i].Id == id && !messages[i].IsSystem {
+				change(&messages[i])
+				break
+			}
+		}
+	}
+	if m.thread.open {
+		m.thread.view.SetContent(m.renderThreadMessages())
+	}
+}
+
+// updateDelivery changes the state of a message we sent, as long as
+// it is still pending. Late acknowledgements after a timeout are ignored.
+func (m *model) updateDelivery(update deliveryMsg) {
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		message := &m.messages[i]
+		if message.Nonce != update.nonce || message.Delivery != DeliveryPending {
+			continue
+		}
+
+		message.Delivery = update.state
+		if update.state == DeliverySent {
+			message.Id = update.id
+			message.Timestamp = update.timestamp
+			m.addToThread(*message)
+		}
+		m.viewport.SetContent(m.renderMessages())
+		return
+	}
+}
+
+// addSystemMessage shows a message that only exists locally, e.g.
+// the usage of a command, without going through the ChatUI
+func (m *model) addSystemMessage(format string, args ...interface{}) {
+	m.messages = append(m.messages, ChatMessage{
+		Timestamp: time.Now(),
+		Content:   fmt.Sprintf(format, args...),
+		IsSystem:  true,
+	})
+	m.viewport.SetContent(m.renderMessages())
+	m.viewport.GotoBottom()
+}
+
+func (m *model) requestHistory() {
+	if !m.ready || m.loadingHistory || m.historyComplete || m.actions.RequestHistory == nil {
+		return
+	}
+
+	// Page by the oldest message id we know, or by time
+	// if we haven't received any stored messages yet
+	var beforeId uint64
+	before := time.Now()
+
+	for _, message := range m.messages {
+		if message.Id != 0 {
+			beforeId = message.Id
+			break
+		}
+		if !message.IsDivider && message.Timestamp.Before(before) {
+			before = message.Timestamp
+		}
+	}
+
+	m.loadingHistory = true
+	m.actions.RequestHistory(beforeId, before)
+}
+
+// insertHistory puts history messages in front of the current
+// messages, separated by a divider from what we received live
+func insertHistory(current []ChatMessage, history []ChatMessage) []ChatMessage {
+	if len(history) == 0 {
+		return current
+	}
+
+	messages := make([]ChatMessage, 0, len(history)+len(current)+1)
+	messages = append(messages, history...)
+
+	if !slices.ContainsFunc(current, func(message ChatMessage) bool { return message.IsDivider }) {
+		messages = append(messages, ChatMessage{IsDivider: true})
+	}
+	return append(messages, current...)
+}
+
+// formatTimestamp includes the date for messages from previous days
+func formatTimestamp(timestamp time.Time) string {
+	now := time.Now()
+	if timestamp.YearDay() != now.YearDay() || timestamp.Year() != now.Year() {
+		return timestamp.Format("Jan 02 15:04")
+	}
+	return timestamp.Format("15:04:05")
 }
 
 func (m model) renderUserList() string {
@@ -359,7 +926,7 @@ func (m model) renderUserList() string {
 	lines = append(lines, "")
 
 	for _, user := range m.users {
-		lines = append(lines, "• "+user)
+		lines = append(lines, m.renderUser(user))
 	}
 
 	content := strings.Join(lines, "\n")
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	cardStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("245")).
+			Padding(0, 1)
+
+	cardLabelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("244")).
+			Width(11)
+)
+
+// ShowWhois shows the information about a user as a card in the chat
+func (ui *ChatUI) ShowWhois(info protocol.WhoisInfo) {
+	ui.mu.Lock()
+	if ui.quitting {
+		ui.mu.Unlock()
+		return
+	}
+	msg := ChatMessage{
+		Timestamp: time.Now(),
+		IsSystem:  true,
+		Whois:     &info,
+	}
+	ui.messages = append(ui.messages, msg)
+	ui.mu.Unlock()
+
+	if ui.program != nil {
+		ui.program.Send(newMessageMsg(msg))
+	}
+}
+
+func whoisCommand(m *model, args string) tea.Cmd {
+	if args == "" || strings.Contains(args, " ") {
+		m.addSystemMessage("usage: /whois <nickname>")
+		return nil
+	}
+	if m.actions.Whois != nil {
+		m.actions.Whois(args)
+	}
+	return nil
+}
+
+// renderWhois renders the information about a user as a card
+func renderWhois(info *protocol.WhoisInfo) string {
+	connectedAt := time.UnixMilli(info.ConnectedAt)
+	idle := time.Duration(info.Idle) * time.Millisecond
+
+	status := "Online"
+	switch info.State {
+	case protocol.PresenceAway:
+		status = "Away: " + awayMessage(protocol.Presence{Message: info.AwayMessage})
+	case protocol.PresenceDoNotDisturb:
+		status = "Do not disturb: " + awayMessage(protocol.Presence{Message: info.AwayMessage})
+	}
+
+	encrypted := "no"
+	if info.Encrypted {
+		encrypted = "yes"
+	}
+
+	rows := [][2]string{
+		{"Status", status},
+		{"Connected", fmt.Sprintf("%s (%s ago)", formatTimestamp(connectedAt), formatDuration(time.Since(connectedAt)))},
+		{"Idle", formatDuration(idle)},
+		{"Client", info.Client},
+		{"Encrypted", encrypted},
+	}
+
+	lines := []string{senderStyle.Render(info.Name)}
+	for _, row := range rows {
+		lines = append(lines, cardLabelStyle.Render(row[0])+row[1])
+	}
+	return cardStyle.Render(strings.Join(lines, "\n"))
+}
+
+// formatDuration shortens a duration to its two largest units
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"net"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/Lekuruu/go-chat/internal/logging"
 	"github.com/Lekuruu/go-chat/internal/protocol"
@@ -13,7 +18,42 @@ type Client struct {
 	Server          *ChatServer
 	Logger          *logging.Logger
 	Encryption      protocol.EncryptionType
+	EncryptionKey   []byte
 	IsAuthenticated bool
+	ConnectedAt     time.Time
+
+	// Version is the protocol version the client used to authenticate,
+	// and Software the name & version of the client, if it sent them
+	Version  uint8
+	Software string
+
+	// Frontend translates packets for clients that
+	// don't speak ECP, and is nil for regular clients
+	Frontend Frontend
+
+	// Link is set once the client identified itself as another server
+	Link *Link
+
+	// challenge is the challenge the client was answered with, and
+	// linkNonce the nonce the accepting side of a link picked. Linking
+	// servers include both in their link secret proof.
+	challenge []byte
+	linkNonce []byte
+
+	flood      floodState
+	writeMutex sync.Mutex
+
+	// lastTyping is when the client's typing state was last
+	// relayed, and is only used by the reading goroutine
+	lastTyping time.Time
+
+	presence      presenceState
+	presenceMutex sync.Mutex
+}
+
+// Frontend encodes packets for clients that use a different protocol
+type Frontend interface {
+	WritePacket(w io.Writer, packet *protocol.Packet) error
 }
 
 func (c *Client) Close() error {
@@ -21,17 +61,51 @@ func (c *Client) Close() error {
 }
 
 func (c *Client) Address() string {
-	return c.Conn.RemoteAddr().String()
+	return remoteAddress(c.Conn)
 }
 
 func (c *Client) ReadPacket() (*protocol.Packet, error) {
-	return protocol.DeserializePacket(c.Conn, c.Server.EncryptionKey)
+	return protocol.DeserializePacket(c.Conn, c.EncryptionKey)
 }
 
 func (c *Client) SendPacket(packet *protocol.Packet) error {
 	packet.Version = c.Server.Version
 	packet.Encryption = c.Encryption
-	return packet.Serialize(c.Conn, c.Server.EncryptionKey)
+
+	// Write the packet at once, so that message based
+	// transports like websockets receive it in one frame
+	buffer := new(bytes.Buffer)
+
+	if c.Frontend != nil {
+		if err := c.Frontend.WritePacket(buffer, packet); err != nil {
+			return err
+		}
+		return c.Write(buffer.Bytes())
+	}
+
+	if err := packet.Serialize(buffer, c.EncryptionKey); err != nil {
+		return err
+	}
+	return c.Write(buffer.Bytes())
+}
+
+// Write sends raw data to the client. Packets may be sent from other
+// clients' goroutines, so this makes sure that writes don't interleave.
+func (c *Client) Write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	_, err := c.Conn.Write(data)
+	return err
+}
+
+// IsModerator reports whether the client may change messages of others
+func (c *Client) IsModerator() bool {
+	return slices.Contains(c.Server.Config().Moderators, c.Name)
 }
 
 func (c *Client) SendError(e *ChatError) error {
@@ -43,7 +117,7 @@ func (c *Client) SendError(e *ChatError) error {
 }
 
 func NewClient(conn net.Conn, server *ChatServer) *Client {
-	address := conn.RemoteAddr().String()
+	address := remoteAddress(conn)
 	logger := logging.CreateLogger(address, server.Logger.GetLevel())
 
 	return &Client{
@@ -52,6 +126,18 @@ func NewClient(conn net.Conn, server *ChatServer) *Client {
 		Server:          server,
 		Logger:          logger,
 		Encryption:      protocol.EncryptionTypeNone,
+		EncryptionKey:   server.Config().SecretKey,
 		IsAuthenticated: false,
+		ConnectedAt:     time.Now(),
+		presence:        presenceState{lastActive: time.Now()},
+	}
+}
+
+func remoteAddress(conn net.Conn) string {
+	address := conn.RemoteAddr().String()
+	if address == "" {
+		// Unix socket peers are usually unnamed
+		return conn.RemoteAddr().Network()
 	}
+	return address
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/history"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+func handleEditMessage(packet *protocol.Packet, client *Client) {
+	var edit protocol.MessageEdit
+
+	if err := edit.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message edit: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+	client.markActive()
+
+	if client.allowMessage() != nil {
+		return
+	}
+
+	content, chatError := validateMessage(edit.Content, client.Server.Config())
+	if chatError != nil {
+		client.Logger.Warningf("Rejected edit: %s", chatError.Message)
+		client.SendError(chatError)
+		return
+	}
+
+	changeMessage(client, edit.Id, history.KindEdit, content)
+}
+
+func handleDeleteMessage(packet *protocol.Packet, client *Client) {
+	var messageId protocol.MessageId
+
+	if err := messageId.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message id: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+	client.markActive()
+
+	if client.allowMessage() != nil {
+		return
+	}
+
+	changeMessage(client, messageId.Id, history.KindDelete, "")
+}
+
+// changeMessage stores an edit or deletion, if the client is
+// allowed to change the message, and broadcasts it to everyone
+func changeMessage(client *Client, id uint64, kind history.RecordKind, content string) {
+	message, ok := getMessage(client, id)
+	if !ok {
+		return
+	}
+
+	if message.Sender != client.Name && !client.IsModerator() {
+		client.Logger.Warningf("Attempted to change message %d of %s", id, message.Sender)
+		client.SendError(ErrNotPermitted)
+		return
+	}
+
+	packet, err := applyChange(client.Server, message, client.Name, kind, content)
+	if err != nil {
+		client.Logger.Errorf("Failed to change message %d: %v", id, err)
+		return
+	}
+
+	switch kind {
+	case history.KindEdit:
+		client.Logger.Infof("Edited message %d: '%s'", id, content)
+	case history.KindDelete:
+		client.Logger.Infof("Deleted message %d", id)
+	}
+
+	// Linked servers find the message by our id, so changes
+	// to messages from other servers are only applied here
+	if message.Origin == "" {
+		relayLocalEvent(client.Server, packet.Id, packet.Data)
+	}
+}
+
+// applyChange stores an edit or deletion of a message, and
+// broadcasts the packet describing it to all local users
+func applyChange(server *ChatServer, message *history.Record, sender string, kind history.RecordKind, content string) (*protocol.Packet, error) {
+	change := &history.Record{
+		Timestamp: time.Now(),
+		Sender:    sender,
+		Content:   content,
+		Kind:      kind,
+		Target:    message.Id,
+	}
+	if err := server.History.Append(change); err != nil {
+		return nil, err
+	}
+
+	var packet *protocol.Packet
+	var err error
+
+	switch kind {
+	case history.KindEdit:
+		if server.Search != nil {
+			server.Search.Add(message.Id, message.Sender, message.Timestamp, content)
+		}
+		packet, err = messagePacket(protocol.PacketIdEditMessage, &protocol.MessageEdit{Id: message.Id, Content: content})
+	case history.KindDelete:
+		if server.Search != nil {
+			server.Search.Remove(message.Id)
+		}
+		packet, err = messagePacket(protocol.PacketIdDeleteMessage, &protocol.MessageId{Id: message.Id})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	server.Broadcast(packet, nil)
+	return packet, nil
+}
+
+// getMessage reads a message that may be changed, and
+// tells the client if it doesn't exist (anymore)
+func getMessage(client *Client, id uint64) (*history.Record, bool) {
+	store := client.Server.History
+	if store == nil {
+		// Without a history, messages have no ids to refer to
+		client.SendError(ErrMessageNotFound)
+		return nil, false
+	}
+
+	records, err := store.Get(id)
+	if err != nil {
+		client.Logger.Errorf("Failed to read message %d: %v", id, err)
+		return nil, false
+	}
+	if len(records) == 0 || records[0].Deleted {
+		client.SendError(ErrMessageNotFound)
+		return nil, false
+	}
+	return records[0], true
+}
+
+func messagePacket(packetId protocol.PacketId, payload protocol.Serializable) (*protocol.Packet, error) {
+	data, err := payload.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.Packet{Id: packetId, Data: data}, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/Lekuruu/go-chat/internal/protocol"
 )
@@ -46,4 +47,25 @@ var (
 	ErrNicknameInUse        = NewChatError(3, "This nickname is already in use. Please choose another one!")
 	ErrAlreadyAuthenticated = NewChatError(4, "You are already authenticated.")
 	ErrEncryptionRequired   = NewChatError(5, "Encryption is required to perform this action.")
+	ErrInvalidNickname      = NewChatError(6, "This nickname is not allowed. Please choose another one!")
+	ErrLinkRejected         = NewChatError(7, "This server does not accept the link.")
+	ErrServerFull           = NewChatError(8, "The server is full. Please try again later!")
+	ErrTooManyConnections   = NewChatError(9, "There are too many connections from your address.")
+	ErrConnectingTooFast    = NewChatError(10, "You are connecting too fast. Please wait a minute!")
+	ErrRateLimited          = NewChatError(protocol.ErrorCodeRateLimited, "You are sending messages too fast. Please slow down!")
+	ErrMuted                = NewChatError(protocol.ErrorCodeMuted, fmt.Sprintf("You have been muted for %s for flooding.", FloodMuteDuration))
+	ErrFlooding             = NewChatError(protocol.ErrorCodeFlooding, "You have been disconnected for flooding.")
+	ErrMessageTooLong       = NewChatError(14, "Your message is too long. Please shorten it!")
+	ErrInvalidEncoding      = NewChatError(15, "Your message is not valid UTF-8.")
+	ErrControlSequence      = NewChatError(16, "Your message contains terminal control sequences, which are not allowed.")
+	ErrEmptyMessage         = NewChatError(17, "You can't send an empty message.")
+	ErrMessageNotFound      = NewChatError(18, "This message does not exist anymore.")
+	ErrNotPermitted         = NewChatError(19, "You can only change your own messages.")
+	ErrInvalidReaction      = NewChatError(20, "This reaction is not allowed.")
+	ErrTooManyReactions     = NewChatError(21, "This message has too many different reactions.")
+	ErrAwayMessageTooLong   = NewChatError(22, fmt.Sprintf("Your away message can't be longer than %d characters.", MaxAwayMessageLength))
+	ErrNoSuchUser           = NewChatError(23, "There is no user with this name on this server.")
+	ErrInvalidMessageKind   = NewChatError(24, "You are not allowed to send this kind of message.")
+	ErrQueryLimit           = NewChatError(protocol.ErrorCodeQueryLimit, "You are loading messages too fast. Please wait a moment!")
+	ErrAlreadyLinked        = NewChatError(26, "This server is already linked with yours.")
 )
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/ratelimit"
+)
+
+const (
+	// FloodWarnings is the number of violations that are
+	// answered with a warning, before the client is muted
+	FloodWarnings = 3
+
+	// FloodMuteDuration is how long a flooding client is muted
+	FloodMuteDuration = 30 * time.Second
+
+	// FloodDisconnectStrikes is the number of
+	// violations after which a client is disconnected
+	FloodDisconnectStrikes = 6
+
+	// FloodStrikeTimeout is how long a client has to behave,
+	// before its previous violations are forgiven
+	FloodStrikeTimeout = time.Minute
+
+	// QueryRate and QueryBurst limit how often a client may
+	// load messages from the history, per second
+	QueryRate  = 2
+	QueryBurst = 10
+)
+
+// floodState tracks the message rate of a client. It is only
+// used by the goroutine reading from the client's connection.
+type floodState struct {
+	bucket     *ratelimit.Bucket
+	strikes    int
+	lastStrike time.Time
+	mutedUntil time.Time
+
+	// queries limits requests reading from the history,
+	// which are more expensive to answer than messages
+	queries *ratelimit.Bucket
+}
+
+// allowMessage checks whether the client may send another message, and
+// returns the error it was sent otherwise. Clients exceeding the rate
+// are warned, then muted and eventually disconnected, if they keep
+// sending messages.
+func (client *Client) allowMessage() *ChatError {
+	serverConfig := client.Server.Config()
+	if serverConfig.MessageRate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	flood := &client.flood
+
+	if flood.bucket == nil {
+		flood.bucket = ratelimit.NewBucket(serverConfig.MessageRate, serverConfig.MessageBurst)
+	}
+	// Apply config changes to existing clients as well
+	flood.bucket.Rate = serverConfig.MessageRate
+	flood.bucket.Burst = serverConfig.MessageBurst
+
+	if flood.strikes > 0 && now.Sub(flood.lastStrike) > FloodStrikeTimeout {
+		flood.strikes = 0
+	}
+
+	muted := now.Before(flood.mutedUntil)
+	if !muted && flood.bucket.AllowAt(now) {
+		return nil
+	}
+
+	flood.strikes++
+	flood.lastStrike = now
+
+	switch {
+	case flood.strikes >= FloodDisconnectStrikes:
+		client.Logger.Warning("Disconnecting client for flooding")
+		client.SendError(ErrFlooding)
+		client.Close()
+		return ErrFlooding
+	case muted:
+		client.SendError(ErrMuted)
+		return ErrMuted
+	case flood.strikes > FloodWarnings:
+		client.Logger.Warningf("Muting client for %s", FloodMuteDuration)
+		flood.mutedUntil = now.Add(FloodMuteDuration)
+		client.SendError(ErrMuted)
+		return ErrMuted
+	default:
+		client.SendError(ErrRateLimited)
+		return ErrRateLimited
+	}
+}
+
+// allowQuery reports whether the client may read from the history
+// again. Unlike messages, exceeding the rate is not punished, since
+// clients request older pages automatically while scrolling.
+func (client *Client) allowQuery() bool {
+	if client.flood.queries == nil {
+		client.flood.queries = ratelimit.NewBucket(QueryRate, QueryBurst)
+	}
+	if client.flood.queries.Allow() {
+		return true
+	}
+	client.SendError(ErrQueryLimit)
+	return false
+}
@@ -2,17 +2,37 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"time"
 
+	"github.com/Lekuruu/go-chat/internal/history"
 	"github.com/Lekuruu/go-chat/internal/protocol"
 )
 
+// NoticeSender is the sender of notices on
+// servers without a configured server_name
+const NoticeSender = "server"
+
 var AuthHandlers = make(map[protocol.PacketId]func(*protocol.Packet, *Client))
 var MainHandlers = make(map[protocol.PacketId]func(*protocol.Packet, *Client))
 
 func init() {
 	AuthHandlers[protocol.PacketIdChallenge] = handleAuthChallenge
 	AuthHandlers[protocol.PacketIdNickname] = handleNickname
+	AuthHandlers[protocol.PacketIdLinkNonce] = handleLinkNonce
+	AuthHandlers[protocol.PacketIdLinkHello] = handleLinkHello
 	MainHandlers[protocol.PacketIdMessage] = handleMessage
+	MainHandlers[protocol.PacketIdHistoryRequest] = handleHistoryRequest
+	MainHandlers[protocol.PacketIdSearch] = handleSearch
+	MainHandlers[protocol.PacketIdSearchContext] = handleSearchContext
+	MainHandlers[protocol.PacketIdEditMessage] = handleEditMessage
+	MainHandlers[protocol.PacketIdDeleteMessage] = handleDeleteMessage
+	MainHandlers[protocol.PacketIdReact] = handleReaction
+	MainHandlers[protocol.PacketIdThreadRequest] = handleThreadRequest
+	MainHandlers[protocol.PacketIdTyping] = handleTyping
+	MainHandlers[protocol.PacketIdPresence] = handlePresence
+	MainHandlers[protocol.PacketIdWhois] = handleWhois
 }
 
 func handleAuthChallenge(packet *protocol.Packet, client *Client) {
@@ -40,6 +60,7 @@ func handleAuthChallenge(packet *protocol.Packet, client *Client) {
 		Data: responseBuffer.Bytes(),
 	}
 	client.Encryption = protocol.EncryptionTypeAES
+	client.challenge = challenge.Data
 
 	if err := client.SendPacket(response); err != nil {
 		client.Logger.Errorf("Failed to send challenge response: %v", err)
@@ -53,30 +74,37 @@ func handleNickname(packet *protocol.Packet, client *Client) {
 		return
 	}
 
-	if client.Encryption == protocol.EncryptionTypeNone && client.Server.RequireEncryption {
+	if client.Encryption == protocol.EncryptionTypeNone && client.Server.Config().EncryptionEnabled {
 		client.Logger.Warning("Client attempted to set nickname without encryption")
 		client.SendError(ErrEncryptionRequired)
 		return
 	}
 
-	var nicknameString protocol.String
+	var nicknameData protocol.Nickname
 
-	if err := nicknameString.FromBytes(packet.Data); err != nil {
+	if err := nicknameData.FromBytes(packet.Data); err != nil {
 		client.Logger.Errorf("Failed to read nickname: %v", err)
 		client.SendError(ErrInvalidPacket)
 		return
 	}
-	nickname := nicknameString.Value
+	nickname := nicknameData.Name
 
-	if _, exists := client.Server.Clients[nickname]; exists {
-		client.Logger.Warningf("Nickname already in use: %s", nickname)
-		client.SendError(ErrNicknameInUse)
+	if !validName(nickname) {
+		client.Logger.Warningf("Invalid nickname: %q", nickname)
+		client.SendError(ErrInvalidNickname)
 		return
 	}
 
 	client.Name = nickname
+	client.Version = packet.Version
+	client.Software = clientSoftware(nicknameData.Client)
+	if !client.Server.AddClient(client) {
+		client.Logger.Warningf("Nickname already in use: %s", nickname)
+		client.SendError(ErrNicknameInUse)
+		client.Name = ""
+		return
+	}
 	client.IsAuthenticated = true
-	client.Server.Clients[client.Name] = client
 
 	nicknameAck := &protocol.Packet{Id: protocol.PacketIdNicknameAck}
 	if err := client.SendPacket(nicknameAck); err != nil {
@@ -85,8 +113,9 @@ func handleNickname(packet *protocol.Packet, client *Client) {
 	}
 
 	// Send list of existing users to client
-	users := make([]protocol.User, 0, len(client.Server.Clients))
-	for name := range client.Server.Clients {
+	names := client.Server.UserNames()
+	users := make([]protocol.User, 0, len(names))
+	for _, name := range names {
 		users = append(users, protocol.User{Name: name})
 	}
 
@@ -105,6 +134,11 @@ func handleNickname(packet *protocol.Packet, client *Client) {
 	if err := client.SendPacket(namePacket); err != nil {
 		client.Logger.Errorf("Failed to send user list: %v", err)
 	}
+
+	sendPresences(client)
+
+	// Show the client what was discussed before it joined
+	sendHistory(client)
 }
 
 func handleMessage(packet *protocol.Packet, client *Client) {
@@ -115,8 +149,58 @@ func handleMessage(packet *protocol.Packet, client *Client) {
 		client.SendError(ErrInvalidPacket)
 		return
 	}
+	client.markActive()
+
+	if chatError := client.allowMessage(); chatError != nil {
+		if chatError != ErrFlooding {
+			// Flooding clients were disconnected already
+			sendMessageAck(client, message.Nonce, nil, chatError.Code)
+		}
+		return
+	}
+
+	if !allowedKind(message.Kind) {
+		client.Logger.Warningf("Rejected message of kind %d", message.Kind)
+		client.SendError(ErrInvalidMessageKind)
+		sendMessageAck(client, message.Nonce, nil, ErrInvalidMessageKind.Code)
+		return
+	}
+
+	content, chatError := validateMessage(message.Content, client.Server.Config())
+	if chatError != nil {
+		client.Logger.Warningf("Rejected message: %s", chatError.Message)
+		client.SendError(chatError)
+		sendMessageAck(client, message.Nonce, nil, chatError.Code)
+		return
+	}
 
+	if message.ParentId != 0 {
+		parentId, ok := threadRoot(client, message.ParentId)
+		if !ok {
+			sendMessageAck(client, message.Nonce, nil, ErrMessageNotFound.Code)
+			return
+		}
+		message.ParentId = parentId
+	}
+
+	// Clients may only send messages in their own name
+	message.Sender = client.Name
+	message.Content = content
+	broadcastMessage(client, message)
+}
+
+func broadcastMessage(client *Client, message protocol.Message) {
 	client.Logger.Infof("'%s'", message.Content)
+	record := client.Server.StoreMessage(message)
+
+	// The nonce is only meant for the sender
+	nonce := message.Nonce
+	message.Nonce = 0
+	message.Id = 0
+
+	if record != nil {
+		message.Id = record.Id
+	}
 
 	messageBuffer := new(bytes.Buffer)
 	if err := message.Serialize(messageBuffer); err != nil {
@@ -129,11 +213,74 @@ func handleMessage(packet *protocol.Packet, client *Client) {
 		Data: messageBuffer.Bytes(),
 	}
 
-	for _, targetClient := range client.Server.Clients {
+	for _, targetClient := range client.Server.ClientList() {
+		if targetClient == client && nonce != 0 {
+			// The sender already shows its message, and
+			// only needs to know that it was delivered
+			sendMessageAck(client, nonce, record, 0)
+			continue
+		}
 		if err := targetClient.SendPacket(broadcastPacket); err != nil {
 			client.Logger.Errorf("Failed to send message to %s: %v", targetClient.Name, err)
 		}
 	}
+
+	relayLocalEvent(client.Server, protocol.PacketIdMessage, broadcastPacket.Data)
+}
+
+// broadcastNotice sends a notice from the server to every local user.
+// Notices are neither stored nor relayed to linked servers.
+func broadcastNotice(server *ChatServer, format string, args ...interface{}) {
+	sender := server.Config().ServerName
+	if sender == "" {
+		sender = NoticeSender
+	}
+
+	notice := protocol.Message{
+		Sender:  sender,
+		Content: fmt.Sprintf(format, args...),
+		Kind:    protocol.MessageKindNotice,
+	}
+
+	data, err := notice.ToBytes()
+	if err != nil {
+		server.Logger.Errorf("Failed to serialize notice: %v", err)
+		return
+	}
+	server.Broadcast(&protocol.Packet{Id: protocol.PacketIdMessage, Data: data}, nil)
+}
+
+// sendMessageAck tells the client whether its message was delivered,
+// if the client asked for it by sending a nonce with the message
+func sendMessageAck(client *Client, nonce uint64, record *history.Record, code uint16) {
+	if nonce == 0 {
+		return
+	}
+
+	ack := protocol.MessageAck{
+		Nonce:     nonce,
+		Timestamp: time.Now().UnixMilli(),
+		Code:      code,
+	}
+	if record != nil {
+		ack.Id = record.Id
+		ack.Timestamp = record.Timestamp.UnixMilli()
+	}
+
+	data, err := ack.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize message acknowledgement: %v", err)
+		return
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdMessageAck,
+		Data: data,
+	}
+
+	if err := client.SendPacket(packet); err != nil {
+		client.Logger.Errorf("Failed to send message acknowledgement: %v", err)
+	}
 }
 
 func broadcastJoin(client *Client) {
@@ -149,7 +296,7 @@ func broadcastJoin(client *Client) {
 		Data: data,
 	}
 
-	for _, targetClient := range client.Server.Clients {
+	for _, targetClient := range client.Server.ClientList() {
 		if targetClient.Name == client.Name {
 			continue
 		}
@@ -157,6 +304,8 @@ func broadcastJoin(client *Client) {
 			client.Logger.Errorf("Failed to send join to %s: %v", targetClient.Name, err)
 		}
 	}
+
+	relayLocalEvent(client.Server, protocol.PacketIdJoin, data)
 }
 
 func broadcastQuit(client *Client) {
@@ -172,7 +321,7 @@ func broadcastQuit(client *Client) {
 		Data: data,
 	}
 
-	for _, targetClient := range client.Server.Clients {
+	for _, targetClient := range client.Server.ClientList() {
 		if targetClient.Name == client.Name {
 			continue
 		}
@@ -180,4 +329,30 @@ func broadcastQuit(client *Client) {
 			client.Logger.Errorf("Failed to send quit to %s: %v", targetClient.Name, err)
 		}
 	}
+
+	relayLocalEvent(client.Server, protocol.PacketIdQuit, data)
+}
+
+func broadcastShutdown(server *ChatServer, ctx context.Context, reason string) {
+	message := protocol.String{Value: reason}
+	data, err := message.ToBytes()
+	if err != nil {
+		server.Logger.Errorf("Failed to serialize shutdown reason: %v", err)
+		return
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdServerShutdown,
+		Data: data,
+	}
+
+	for _, targetClient := range server.ClientList() {
+		// Don't let a stalled client block the shutdown
+		if deadline, ok := ctx.Deadline(); ok {
+			targetClient.Conn.SetWriteDeadline(deadline)
+		}
+		if err := targetClient.SendPacket(packet); err != nil {
+			server.Logger.Errorf("Failed to send shutdown to %s: %v", targetClient.Name, err)
+		}
+	}
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/history"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+// HistoryPageSize is the maximum number of messages per history request
+const HistoryPageSize = 100
+
+// openHistory opens the configured history backend, or returns nil
+// if the history is disabled. The dropped function is called with
+// the oldest remaining id, after retention deleted older messages.
+func openHistory(serverConfig *config.Config, dropped func(firstId uint64)) (history.Store, error) {
+	if serverConfig.HistoryPath == "" {
+		return nil, nil
+	}
+
+	options := history.LogOptions{
+		SegmentSize: serverConfig.HistorySegmentSize,
+		MaxSize:     serverConfig.HistoryMaxSize,
+		MaxAge:      time.Duration(serverConfig.HistoryMaxAgeDays) * 24 * time.Hour,
+		Dropped:     dropped,
+	}
+	return history.OpenLog(serverConfig.HistoryPath, options)
+}
+
+// StoreMessage appends a message to the history, if enabled
+func (server *ChatServer) StoreMessage(message protocol.Message) *history.Record {
+	return server.StoreRemoteMessage(message, "", 0)
+}
+
+// StoreRemoteMessage appends a message that was relayed from a linked
+// server to the history, along with the id the origin server assigned
+func (server *ChatServer) StoreRemoteMessage(message protocol.Message, origin string, originId uint64) *history.Record {
+	if server.History == nil {
+		return nil
+	}
+
+	record := &history.Record{
+		Timestamp: time.Now(),
+		Sender:    message.Sender,
+		Content:   message.Content,
+		Parent:    message.ParentId,
+		Action:    message.Kind == protocol.MessageKindAction,
+		Origin:    origin,
+		OriginId:  originId,
+	}
+
+	if err := server.History.Append(record); err != nil {
+		server.Logger.Errorf("Failed to store message: %v", err)
+		return nil
+	}
+
+	if server.Search != nil {
+		server.Search.Add(record.Id, record.Sender, record.Timestamp, record.Content)
+	}
+	return record
+}
+
+// sendHistory sends the most recent messages to a client that just joined
+func sendHistory(client *Client) {
+	count := client.Server.Config().HistoryReplay
+	if client.Server.History == nil || count <= 0 {
+		return
+	}
+
+	records, err := client.Server.History.Last(count)
+	if err != nil {
+		client.Logger.Errorf("Failed to read message history: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	sendHistoryBatch(client, records)
+}
+
+func sendHistoryBatch(client *Client, records []*history.Record) {
+	batch := historyBatch(records)
+	data, err := batch.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize message history: %v", err)
+		return
+	}
+
+	packet := &protocol.Packet{
+		Id:   protocol.PacketIdHistory,
+		Data: data,
+	}
+
+	if err := client.SendPacket(packet); err != nil {
+		client.Logger.Errorf("Failed to send message history: %v", err)
+	}
+}
+
+// handleHistoryRequest answers with a page of messages, that
+// were sent before the given message id or timestamp
+func handleHistoryRequest(packet *protocol.Packet, client *Client) {
+	var request protocol.HistoryRequest
+
+	if err := request.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize history request: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	if !client.allowQuery() {
+		return
+	}
+
+	if client.Server.History == nil {
+		// Without a history, there is nothing left to load
+		sendHistoryBatch(client, nil)
+		return
+	}
+
+	limit := min(max(int(request.Limit), 1), HistoryPageSize)
+	var records []*history.Record
+	var err error
+
+	if request.BeforeId != 0 {
+		records, err = client.Server.History.Before(request.BeforeId, limit)
+	} else {
+		records, err = client.Server.History.BeforeTime(time.UnixMilli(request.BeforeTimestamp), limit)
+	}
+	if err != nil {
+		client.Logger.Errorf("Failed to read message history: %v", err)
+		return
+	}
+
+	// An empty batch tells the client that there is nothing left
+	sendHistoryBatch(client, records)
+}
+
+func historyBatch(records []*history.Record) protocol.HistoryBatch {
+	messages := make([]protocol.HistoryMessage, 0, len(records))
+	for _, record := range records {
+		messages = append(messages, protocol.HistoryMessage{
+			Id:        record.Id,
+			Timestamp: record.Timestamp.UnixMilli(),
+			Sender:    record.Sender,
+			Content:   record.Content,
+			Edited:    record.Edited,
+			Deleted:   record.Deleted,
+			Reactions: protocolReactions(record.Reactions),
+			ParentId:  record.Parent,
+			Kind:      messageKind(record),
+		})
+	}
+	return protocol.HistoryBatch{Messages: messages}
+}
+
+func messageKind(record *history.Record) protocol.MessageKind {
+	if record.Action {
+		return protocol.MessageKindAction
+	}
+	return protocol.MessageKindNormal
+}
+
+func (server *ChatServer) CloseHistory() {
+	if server.History == nil {
+		return
+	}
+	if err := server.History.Close(); err != nil {
+		server.Logger.Errorf("Failed to close message history: %v", err)
+	}
+}
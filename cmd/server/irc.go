@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Lekuruu/go-chat/internal/irc"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+// IRCChannel is the only channel on the server, which
+// contains every user, regardless of their protocol
+const IRCChannel = "#chat"
+
+// IRCServerName is used as the prefix of server messages
+const IRCServerName = "go-chat"
+
+// ircActionPrefix starts the CTCP messages, that IRC
+// clients send for "/me" actions
+const ircActionPrefix = "\x01ACTION "
+
+var IRCHandlers = make(map[string]func(*irc.Message, *IRCSession))
+
+func init() {
+	IRCHandlers["NICK"] = handleIRCNick
+	IRCHandlers["USER"] = handleIRCUser
+	IRCHandlers["PING"] = handleIRCPing
+	IRCHandlers["PONG"] = handleIRCPong
+	IRCHandlers["JOIN"] = handleIRCJoin
+	IRCHandlers["NAMES"] = handleIRCNames
+	IRCHandlers["PRIVMSG"] = handleIRCPrivmsg
+	IRCHandlers["QUIT"] = handleIRCQuit
+}
+
+// IRCSession holds the registration state of an IRC client
+// and translates chat packets into IRC messages for it
+type IRCSession struct {
+	Client   *Client
+	Nickname string
+	Username string
+	Realname string
+	quitting bool
+}
+
+// Send writes one or more messages to the client
+func (session *IRCSession) Send(messages ...*irc.Message) error {
+	buffer := new(bytes.Buffer)
+	for _, message := range messages {
+		writeIRCMessage(buffer, message)
+	}
+	return session.Client.Write(buffer.Bytes())
+}
+
+// Reply sends a numeric reply from the server to the client
+func (session *IRCSession) Reply(numeric string, params ...string) error {
+	return session.Send(session.reply(numeric, params...))
+}
+
+func (session *IRCSession) reply(numeric string, params ...string) *irc.Message {
+	target := session.Nickname
+	if target == "" {
+		target = "*"
+	}
+	return irc.NewMessage(IRCServerName, numeric, append([]string{target}, params...)...)
+}
+
+// WritePacket translates chat packets into IRC messages, so
+// IRC users receive the same broadcasts as every ECP client
+func (session *IRCSession) WritePacket(w io.Writer, packet *protocol.Packet) error {
+	switch packet.Id {
+	case protocol.PacketIdMessage:
+		var message protocol.Message
+		if err := message.FromBytes(packet.Data); err != nil {
+			return err
+		}
+		if message.Sender == session.Nickname {
+			// IRC clients show their own messages already
+			return nil
+		}
+		for _, line := range splitIRCText(message.Content) {
+			writeIRCMessage(w, ircChatMessage(message, line))
+		}
+
+	case protocol.PacketIdJoin:
+		var user protocol.User
+		if err := user.FromBytes(packet.Data); err != nil {
+			return err
+		}
+		writeIRCMessage(w, irc.NewMessage(ircPrefix(user.Name), "JOIN", IRCChannel))
+
+	case protocol.PacketIdQuit:
+		var user protocol.User
+		if err := user.FromBytes(packet.Data); err != nil {
+			return err
+		}
+		writeIRCMessage(w, irc.NewMessage(ircPrefix(user.Name), "QUIT", "Quit"))
+
+	case protocol.PacketIdNames:
+		var userList protocol.UserList
+		if err := userList.FromBytes(packet.Data); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(userList.Users))
+		for _, user := range userList.Users {
+			names = append(names, ircName(user.Name))
+		}
+		writeIRCMessage(w, session.reply(irc.RplNamReply, "=", IRCChannel, strings.Join(names, " ")))
+		writeIRCMessage(w, session.reply(irc.RplEndOfNames, IRCChannel, "End of /NAMES list"))
+
+	case protocol.PacketIdError:
+		var chatError protocol.Error
+		if err := chatError.FromBytes(packet.Data); err != nil {
+			return err
+		}
+		writeIRCMessage(w, irc.NewMessage(IRCServerName, "NOTICE", session.Nickname, fmt.Sprintf("Error [%d]: %s", chatError.Code, chatError.Message)))
+
+	case protocol.PacketIdServerShutdown:
+		var reason protocol.String
+		if err := reason.FromBytes(packet.Data); err != nil {
+			return err
+		}
+		writeIRCMessage(w, irc.NewMessage("", "ERROR", "Closing link: "+reason.Value))
+	}
+
+	// Other packets have no IRC equivalent and are dropped
+	return nil
+}
+
+func handleIRCConnection(conn net.Conn, server *ChatServer) {
+	defer conn.Close()
+
+	client := NewClient(conn, server)
+	session := &IRCSession{Client: client}
+	client.Frontend = session
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, irc.MaxLineLength), 4*irc.MaxLineLength)
+
+	for !session.quitting && scanner.Scan() {
+		message, err := irc.Parse(scanner.Text())
+		if err != nil {
+			continue
+		}
+
+		handler, ok := IRCHandlers[message.Command]
+		if !ok {
+			session.Reply(irc.ErrUnknownCommand, message.Command, "Unknown command")
+			continue
+		}
+
+		if !client.IsAuthenticated && !isRegistrationCommand(message.Command) {
+			session.Reply(irc.ErrNotRegistered, "You have not registered")
+			continue
+		}
+
+		handler(message, session)
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		client.Logger.Errorf("Failed to read from IRC client: %v", err)
+	}
+
+	if client.IsAuthenticated {
+		client.Logger.Infof("Client disconnected")
+		server.RemoveClient(client)
+		broadcastQuit(client)
+	}
+}
+
+func isRegistrationCommand(command string) bool {
+	switch command {
+	case "NICK", "USER", "PING", "PONG", "QUIT":
+		return true
+	}
+	return false
+}
+
+func handleIRCNick(message *irc.Message, session *IRCSession) {
+	nickname := message.Param(0)
+	if nickname == "" {
+		session.Reply(irc.ErrNoNicknameGiven, "No nickname given")
+		return
+	}
+	if session.Client.IsAuthenticated {
+		session.Send(irc.NewMessage(IRCServerName, "NOTICE", session.Nickname, "Nickname changes are not supported"))
+		return
+	}
+	if nickname != ircName(nickname) || strings.HasPrefix(nickname, "#") || !validName(nickname) {
+		session.Reply(irc.ErrErroneusNickname, nickname, "Erroneous nickname")
+		return
+	}
+	if _, exists := session.Client.Server.GetClient(nickname); exists {
+		session.Reply(irc.ErrNicknameInUse, nickname, "Nickname is already in use")
+		return
+	}
+
+	session.Nickname = nickname
+	completeIRCRegistration(session)
+}
+
+func handleIRCUser(message *irc.Message, session *IRCSession) {
+	if session.Client.IsAuthenticated {
+		session.Reply(irc.ErrAlreadyRegistred, "You may not reregister")
+		return
+	}
+	if len(message.Params) < 4 {
+		session.Reply(irc.ErrNeedMoreParams, "USER", "Not enough parameters")
+		return
+	}
+
+	session.Username = message.Param(0)
+	session.Realname = message.Param(3)
+	completeIRCRegistration(session)
+}
+
+// completeIRCRegistration adds the client to the chat, once
+// both NICK and USER were received, and joins the channel
+func completeIRCRegistration(session *IRCSession) {
+	if session.Nickname == "" || session.Username == "" {
+		return
+	}
+
+	client := session.Client
+	client.Name = session.Nickname
+
+	if !client.Server.AddClient(client) {
+		// Someone else registered this name in the meantime
+		session.Reply(irc.ErrNicknameInUse, session.Nickname, "Nickname is already in use")
+		session.Nickname = ""
+		client.Name = ""
+		return
+	}
+	client.IsAuthenticated = true
+
+	client.Logger.Infof("IRC client registered with nickname: '%s'", client.Name)
+	client.Logger.SetName(client.Name)
+
+	session.Send(
+		session.reply(irc.RplWelcome, fmt.Sprintf("Welcome to the go-chat network %s", ircPrefix(client.Name))),
+		session.reply(irc.RplYourHost, fmt.Sprintf("Your host is %s", IRCServerName)),
+		session.reply(irc.RplCreated, "This server speaks ECP and IRC"),
+		session.reply(irc.RplMyInfo, IRCServerName, "go-chat"),
+		session.reply(irc.ErrNoMotd, "MOTD File is missing"),
+	)
+
+	// Everyone is in the same room, so we join the channel right away
+	session.Send(irc.NewMessage(ircPrefix(client.Name), "JOIN", IRCChannel))
+	sendIRCNames(session)
+	broadcastJoin(client)
+}
+
+func handleIRCPing(message *irc.Message, session *IRCSession) {
+	session.Send(irc.NewMessage(IRCServerName, "PONG", IRCServerName, message.Param(0)))
+}
+
+func handleIRCPong(message *irc.Message, session *IRCSession) {}
+
+func handleIRCJoin(message *irc.Message, session *IRCSession) {
+	for _, channel := range strings.Split(message.Param(0), ",") {
+		if !strings.EqualFold(channel, IRCChannel) {
+			session.Reply(irc.ErrNoSuchChannel, channel, "No such channel")
+			continue
+		}
+		// Users are always part of the channel, so just repeat the names
+		session.Reply(irc.RplNoTopic, IRCChannel, "No topic is set")
+		sendIRCNames(session)
+	}
+}
+
+func handleIRCNames(message *irc.Message, session *IRCSession) {
+	sendIRCNames(session)
+}
+
+func handleIRCPrivmsg(message *irc.Message, session *IRCSession) {
+	if len(message.Params) < 1 {
+		session.Reply(irc.ErrNoRecipient, "No recipient given (PRIVMSG)")
+		return
+	}
+	if len(message.Params) < 2 || message.Param(1) == "" {
+		session.Reply(irc.ErrNoTextToSend, "No text to send")
+		return
+	}
+
+	target := message.Param(0)
+	if !strings.EqualFold(target, IRCChannel) {
+		session.Reply(irc.ErrNoSuchNick, target, "No such nick/channel")
+		return
+	}
+
+	// IRC clients send pings on their own, so
+	// only messages count as activity
+	session.Client.markActive()
+
+	if session.Client.allowMessage() != nil {
+		return
+	}
+
+	text := message.Param(1)
+	kind := protocol.MessageKindNormal
+
+	if action, ok := parseIRCAction(text); ok {
+		text = action
+		kind = protocol.MessageKindAction
+	}
+
+	content, chatError := validateMessage(text, session.Client.Server.Config())
+	if chatError != nil {
+		session.Client.Logger.Warningf("Rejected message: %s", chatError.Message)
+		session.Client.SendError(chatError)
+		return
+	}
+
+	chatMessage := protocol.Message{
+		Sender:  session.Client.Name,
+		Content: content,
+		Kind:    kind,
+	}
+	broadcastMessage(session.Client, chatMessage)
+}
+
+func handleIRCQuit(message *irc.Message, session *IRCSession) {
+	reason := message.Param(0)
+	if reason == "" {
+		reason = "Client quit"
+	}
+	session.Send(irc.NewMessage("", "ERROR", "Closing link: "+reason))
+	session.quitting = true
+}
+
+func sendIRCNames(session *IRCSession) {
+	names := session.Client.Server.UserNames()
+	users := make([]protocol.User, 0, len(names))
+	for _, name := range names {
+		users = append(users, protocol.User{Name: name})
+	}
+
+	userList := protocol.UserList{Users: users}
+	data, err := userList.ToBytes()
+	if err != nil {
+		session.Client.Logger.Errorf("Failed to serialize user list: %v", err)
+		return
+	}
+	session.Client.SendPacket(&protocol.Packet{Id: protocol.PacketIdNames, Data: data})
+}
+
+// splitIRCText splits message content into lines that
+// fit into a single IRC message, including the prefix
+func splitIRCText(content string) []string {
+	const maxTextLength = 400
+	lines := make([]string, 0, 1)
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		for len(line) > maxTextLength {
+			// Avoid cutting through multi-byte characters
+			cut := maxTextLength
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			lines = append(lines, line[:cut])
+			line = line[cut:]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ircChatMessage translates a line of a chat message into a PRIVMSG,
+// a CTCP action for "/me" messages, or a NOTICE from the server
+func ircChatMessage(message protocol.Message, line string) *irc.Message {
+	switch message.Kind {
+	case protocol.MessageKindAction:
+		return irc.NewMessage(ircPrefix(message.Sender), "PRIVMSG", IRCChannel, ircActionPrefix+line+"\x01")
+	case protocol.MessageKindNotice, protocol.MessageKindSystem:
+		return irc.NewMessage(IRCServerName, "NOTICE", IRCChannel, line)
+	}
+	return irc.NewMessage(ircPrefix(message.Sender), "PRIVMSG", IRCChannel, line)
+}
+
+// parseIRCAction returns the text of a CTCP action, which
+// IRC clients send for "/me" messages
+func parseIRCAction(text string) (string, bool) {
+	if !strings.HasPrefix(text, ircActionPrefix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(text, ircActionPrefix), "\x01"), true
+}
+
+func writeIRCMessage(w io.Writer, message *irc.Message) {
+	io.WriteString(w, message.String()+"\r\n")
+}
+
+// ircName replaces characters that are not allowed in IRC nicknames
+func ircName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ',', '*', '?', '!', '@', ':', '\r', '\n', '\x00':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func ircPrefix(name string) string {
+	name = ircName(name)
+	return fmt.Sprintf("%s!%s@%s", name, name, IRCServerName)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"net"
+
+	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/irc"
+	"github.com/Lekuruu/go-chat/internal/tcp"
+)
+
+func connectionLimits(serverConfig *config.Config) tcp.Limits {
+	return tcp.Limits{
+		MaxConnections:      serverConfig.MaxConnections,
+		MaxConnectionsPerIP: serverConfig.MaxConnectionsPerIP,
+		MaxConnectionRate:   serverConfig.MaxConnectionRate,
+	}
+}
+
+// limitError returns the error shown to clients, that exceeded a connection limit
+func limitError(err error) *ChatError {
+	switch {
+	case errors.Is(err, tcp.ErrTooManyConnectionsForIP):
+		return ErrTooManyConnections
+	case errors.Is(err, tcp.ErrConnectionRateExceeded):
+		return ErrConnectingTooFast
+	default:
+		return ErrServerFull
+	}
+}
+
+// rejectConnection tells an ECP client why it was rejected. The
+// error is sent unencrypted, since no challenge has taken place.
+func rejectConnection(conn net.Conn, server *ChatServer, err error) {
+	client := NewClient(conn, server)
+	client.SendError(limitError(err))
+}
+
+func rejectIRCConnection(conn net.Conn, err error) {
+	writeIRCMessage(conn, irc.NewMessage("", "ERROR", "Closing link: "+limitError(err).Message))
+}
@@ -0,0 +1,833 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/history"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/tcp"
+	"github.com/Lekuruu/go-chat/internal/transport"
+)
+
+// EventCacheSize is the number of recently seen link events,
+// which are remembered to stop them from circling between servers
+const EventCacheSize = 4096
+
+// LinkReconnectDelay is how long to wait before reconnecting
+// to a peer, after an established link was lost
+const LinkReconnectDelay = 5 * time.Second
+
+// LinkChallengeSize is the number of random bytes in the challenge
+// and the nonce of a link, which both servers include in their link
+// secret proof
+const LinkChallengeSize = 16
+
+// errAlreadyLinked is returned when setting up a link to a server,
+// which is already linked through a connection that it dialed
+var errAlreadyLinked = errors.New("server is already linked")
+
+// Link is an authenticated connection to another chat server
+type Link struct {
+	Name   string
+	Client *Client
+
+	// Outbound is set if this server dialed the connection
+	Outbound bool
+}
+
+// dialer returns the name of the server that dialed the link
+func (link *Link) dialer(serverName string) string {
+	if link.Outbound {
+		return serverName
+	}
+	return link.Name
+}
+
+// RemoteUser is a user connected to a linked server
+type RemoteUser struct {
+	Name   string
+	Origin string
+
+	// Link is the connection through which we learned about the user
+	Link *Link
+}
+
+// DisplayName returns the name shown to local users, which
+// includes the origin server to avoid nickname collisions
+func (user *RemoteUser) DisplayName() string {
+	return remoteName(user.Name, user.Origin)
+}
+
+func remoteName(name string, origin string) string {
+	return name + "@" + origin
+}
+
+func (server *ChatServer) RemoteUserList() []*RemoteUser {
+	server.linksMutex.RLock()
+	defer server.linksMutex.RUnlock()
+
+	users := make([]*RemoteUser, 0, len(server.remoteUsers))
+	for _, user := range server.remoteUsers {
+		users = append(users, user)
+	}
+	return users
+}
+
+func (server *ChatServer) LinkList() []*Link {
+	server.linksMutex.RLock()
+	defer server.linksMutex.RUnlock()
+
+	links := make([]*Link, 0, len(server.links))
+	for _, link := range server.links {
+		links = append(links, link)
+	}
+	return links
+}
+
+// AddLink registers a link under the name of the remote server. If
+// two servers dial each other, the link dialed by the server with the
+// lower name is kept on both sides, and the other one is refused or
+// replaced. It returns the replaced link, which has to be closed.
+func (server *ChatServer) AddLink(link *Link) (*Link, bool) {
+	serverName := server.Config().ServerName
+
+	server.linksMutex.Lock()
+	defer server.linksMutex.Unlock()
+
+	existing, exists := server.links[link.Name]
+	if exists && (existing.Outbound == link.Outbound || existing.dialer(serverName) < link.dialer(serverName)) {
+		return nil, false
+	}
+	server.links[link.Name] = link
+
+	if exists {
+		// The remote users are still reachable through the new link
+		for _, user := range server.remoteUsers {
+			if user.Link == existing {
+				user.Link = link
+			}
+		}
+	}
+	return existing, true
+}
+
+// RemoveLink unregisters a link and returns the remote
+// users that were only reachable through it
+func (server *ChatServer) RemoveLink(link *Link) []*RemoteUser {
+	server.linksMutex.Lock()
+	defer server.linksMutex.Unlock()
+
+	if server.links[link.Name] == link {
+		delete(server.links, link.Name)
+		close(server.linkRemoved)
+		server.linkRemoved = make(chan struct{})
+	}
+
+	users := make([]*RemoteUser, 0)
+	for name, user := range server.remoteUsers {
+		if user.Link == link {
+			users = append(users, user)
+			delete(server.remoteUsers, name)
+		}
+	}
+	return users
+}
+
+// LinkRemoved returns a channel, which is closed
+// once the next link was removed
+func (server *ChatServer) LinkRemoved() <-chan struct{} {
+	server.linksMutex.RLock()
+	defer server.linksMutex.RUnlock()
+	return server.linkRemoved
+}
+
+// IsLinked reports whether the link is still registered,
+// or was removed or replaced by another one
+func (server *ChatServer) IsLinked(link *Link) bool {
+	server.linksMutex.RLock()
+	defer server.linksMutex.RUnlock()
+	return server.links[link.Name] == link
+}
+
+// CloseLinks closes the connections to all linked servers
+func (server *ChatServer) CloseLinks() {
+	for _, link := range server.LinkList() {
+		link.Client.Close()
+	}
+}
+
+// maintainLink connects to a peer and keeps reconnecting
+// whenever the link is lost, until the context is cancelled
+func maintainLink(ctx context.Context, server *ChatServer, address string) {
+	dialer := tcp.NewClient("link", "", 0, nil)
+	dialer.Endpoint = address
+	dialer.Logger.SetLevel(server.Logger.GetLevel())
+	dialer.Retry = tcp.RetryPolicy{
+		MaxAttempts:    0,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+	}
+
+	for {
+		conn, err := dialer.Dial(ctx)
+		if err != nil {
+			// Dialing only fails once the context is done
+			return
+		}
+
+		client := NewClient(conn, server)
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		removed := server.LinkRemoved()
+
+		link, err := connectLink(client)
+		switch {
+		case errors.Is(err, errAlreadyLinked):
+			client.Logger.Infof("Already linked with '%s', waiting for the link to end", address)
+			conn.Close()
+		case err != nil:
+			client.Logger.Errorf("Failed to link with '%s': %v", address, err)
+			conn.Close()
+		default:
+			serveLink(link)
+		}
+		stop()
+
+		if errors.Is(err, errAlreadyLinked) {
+			// The peer dialed us as well, and keeps that link up
+			// on its own. We only take over once it was lost.
+			select {
+			case <-ctx.Done():
+				return
+			case <-removed:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(LinkReconnectDelay):
+		}
+	}
+}
+
+// connectLink performs the challenge and introduces
+// this server to the peer, which answers with its name
+func connectLink(client *Client) (*Link, error) {
+	challenge := make([]byte, LinkChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	challengeData := protocol.Challenge{Data: challenge}
+	data, err := challengeData.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendPacket(&protocol.Packet{Id: protocol.PacketIdChallenge, Data: data}); err != nil {
+		return nil, err
+	}
+
+	response, err := client.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	if response.Id != protocol.PacketIdChallenge || response.Encryption != protocol.EncryptionTypeAES {
+		return nil, errors.New("unexpected challenge response")
+	}
+
+	var responseData protocol.Challenge
+	if err := responseData.FromBytes(response.Data); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(responseData.Data, challenge) {
+		return nil, errors.New("challenge mismatch")
+	}
+	client.Encryption = protocol.EncryptionTypeAES
+	client.challenge = challenge
+
+	// The peer picks a nonce of its own, so that
+	// a recorded hello can't be replayed to it
+	if err := client.SendPacket(&protocol.Packet{Id: protocol.PacketIdLinkNonce}); err != nil {
+		return nil, err
+	}
+	response, err = readLinkResponse(client, protocol.PacketIdLinkNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce protocol.Challenge
+	if err := nonce.FromBytes(response.Data); err != nil {
+		return nil, err
+	}
+	client.linkNonce = nonce.Data
+
+	if err := sendLinkHello(client); err != nil {
+		return nil, err
+	}
+	response, err = readLinkResponse(client, protocol.PacketIdLinkHello)
+	if err != nil {
+		return nil, err
+	}
+
+	var hello protocol.LinkHello
+	if err := hello.FromBytes(response.Data); err != nil {
+		return nil, err
+	}
+	if !verifyLinkHello(client, &hello) {
+		return nil, errors.New("peer does not know the link secret")
+	}
+
+	return registerLink(client, hello.Name, true)
+}
+
+// readLinkResponse reads the answer of a peer during link setup,
+// which is either the expected packet or an error
+func readLinkResponse(client *Client, id protocol.PacketId) (*protocol.Packet, error) {
+	response, err := client.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	switch response.Id {
+	case protocol.PacketIdError:
+		var chatError protocol.Error
+		if err := chatError.FromBytes(response.Data); err != nil {
+			return nil, err
+		}
+		if chatError.Code == ErrAlreadyLinked.Code {
+			return nil, errAlreadyLinked
+		}
+		return nil, fmt.Errorf("peer refused link: %s", chatError.Message)
+	case id:
+		if response.Encryption != protocol.EncryptionTypeAES {
+			return nil, errors.New("peer did not encrypt its answer")
+		}
+		return response, nil
+	default:
+		return nil, fmt.Errorf("unexpected packet %d during link setup", response.Id)
+	}
+}
+
+// allowLinking checks if a server may link with us, which
+// requires federation and an encrypted connection
+func allowLinking(packet *protocol.Packet, client *Client) bool {
+	if !client.Server.Config().FederationEnabled {
+		client.Logger.Warning("Server attempted to link, but federation is disabled")
+		client.SendError(ErrLinkRejected)
+		return false
+	}
+
+	if packet.Encryption != protocol.EncryptionTypeAES || client.Encryption != protocol.EncryptionTypeAES {
+		client.Logger.Warning("Server attempted to link without encryption")
+		client.SendError(ErrEncryptionRequired)
+		return false
+	}
+	return true
+}
+
+// handleLinkNonce answers a server that wants to link with a
+// random nonce, which it has to include in its link hello
+func handleLinkNonce(packet *protocol.Packet, client *Client) {
+	if !allowLinking(packet, client) {
+		return
+	}
+
+	nonce := make([]byte, LinkChallengeSize)
+	if _, err := rand.Read(nonce); err != nil {
+		client.Logger.Errorf("Failed to create link nonce: %v", err)
+		client.SendError(ErrLinkRejected)
+		return
+	}
+	client.linkNonce = nonce
+
+	nonceData := protocol.Challenge{Data: nonce}
+	data, err := nonceData.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize link nonce: %v", err)
+		return
+	}
+	if err := client.SendPacket(&protocol.Packet{Id: protocol.PacketIdLinkNonce, Data: data}); err != nil {
+		client.Logger.Errorf("Failed to send link nonce: %v", err)
+	}
+}
+
+// handleLinkHello accepts a link from one of the configured peers,
+// which has to encrypt its hello to prove that it knows our key,
+// and include a proof that it knows the link secret
+func handleLinkHello(packet *protocol.Packet, client *Client) {
+	if !allowLinking(packet, client) {
+		return
+	}
+
+	var hello protocol.LinkHello
+	if err := hello.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to read link hello: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	if !verifyLinkHello(client, &hello) {
+		// Every nonce may only be used for a single attempt
+		client.linkNonce = nil
+		client.Logger.Warningf("Server '%s' attempted to link without the link secret", hello.Name)
+		client.SendError(ErrLinkRejected)
+		return
+	}
+
+	if !isFederationPeer(client.Server.Config().FederationPeers, hello.Name, client.Conn.RemoteAddr()) {
+		client.Logger.Warningf("Server '%s' attempted to link, but is not a federation peer", hello.Name)
+		client.SendError(ErrLinkRejected)
+		return
+	}
+
+	link, err := registerLink(client, hello.Name, false)
+	if errors.Is(err, errAlreadyLinked) {
+		client.Logger.Infof("Refused link: %v", err)
+		client.SendError(ErrAlreadyLinked)
+		return
+	}
+	if err != nil {
+		client.Logger.Warningf("Rejected link: %v", err)
+		client.SendError(ErrLinkRejected)
+		return
+	}
+
+	if err := sendLinkHello(client); err != nil {
+		client.Logger.Errorf("Failed to send link hello: %v", err)
+		client.Server.RemoveLink(link)
+		return
+	}
+	client.Link = link
+}
+
+func sendLinkHello(client *Client) error {
+	config := client.Server.Config()
+	hello := protocol.LinkHello{
+		Name:  config.ServerName,
+		Proof: linkProof(config.LinkSecret, client.challenge, client.linkNonce, config.ServerName),
+	}
+
+	data, err := hello.ToBytes()
+	if err != nil {
+		return err
+	}
+	return client.SendPacket(&protocol.Packet{Id: protocol.PacketIdLinkHello, Data: data})
+}
+
+// linkProof signs the challenge and the nonce of a link together with
+// the name of the server. Since each side picked one of them, a proof
+// can't be replayed on another link or reflected back to its sender.
+func linkProof(secret string, challenge []byte, nonce []byte, name string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(challenge)
+	mac.Write(nonce)
+	mac.Write([]byte(name))
+	return mac.Sum(nil)
+}
+
+func verifyLinkHello(client *Client, hello *protocol.LinkHello) bool {
+	secret := client.Server.Config().LinkSecret
+	if secret == "" || len(client.challenge) < LinkChallengeSize || len(client.linkNonce) < LinkChallengeSize {
+		return false
+	}
+	return hmac.Equal(hello.Proof, linkProof(secret, client.challenge, client.linkNonce, hello.Name))
+}
+
+// isFederationPeer checks if a linking server is one of the
+// configured peers, either by its name or by its address
+func isFederationPeer(peers []string, name string, address net.Addr) bool {
+	remoteHost, _, err := net.SplitHostPort(address.String())
+	if err != nil {
+		remoteHost = address.String()
+	}
+
+	for _, peer := range peers {
+		endpoint, err := transport.ParseEndpoint(peer)
+		if err != nil {
+			continue
+		}
+		host, _, err := net.SplitHostPort(endpoint.Address)
+		if err != nil {
+			host = endpoint.Address
+		}
+		if host == name || host == remoteHost {
+			return true
+		}
+		if addresses, err := net.LookupHost(host); err == nil && slices.Contains(addresses, remoteHost) {
+			return true
+		}
+	}
+	return false
+}
+
+func registerLink(client *Client, name string, outbound bool) (*Link, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid server name %q", name)
+	}
+	if name == client.Server.Config().ServerName {
+		return nil, fmt.Errorf("server '%s' has the same name as this server", name)
+	}
+
+	link := &Link{Name: name, Client: client, Outbound: outbound}
+	replaced, ok := client.Server.AddLink(link)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", errAlreadyLinked, name)
+	}
+	if replaced != nil {
+		client.Logger.Infof("Replacing the other link to server '%s'", name)
+		replaced.Client.Close()
+	}
+
+	client.Name = name
+	client.Logger.SetName("link:" + name)
+	client.Logger.Infof("Linked with server '%s'", name)
+	return link, nil
+}
+
+// serveLink exchanges the user lists and relays events
+// from the linked server, until the connection is lost
+func serveLink(link *Link) {
+	server := link.Client.Server
+	defer unlinkServer(link)
+
+	sendLinkBurst(link)
+	broadcastNotice(server, "Linked with server '%s'", link.Name)
+
+	for {
+		packet, err := link.Client.ReadPacket()
+		if err != nil {
+			link.Client.Logger.Infof("Link closed: %v", err)
+			return
+		}
+
+		if packet.Id != protocol.PacketIdLinkEvent || packet.Encryption != protocol.EncryptionTypeAES {
+			link.Client.Logger.Warningf("Unexpected packet on link: %d", packet.Id)
+			continue
+		}
+
+		var event protocol.LinkEvent
+		if err := event.FromBytes(packet.Data); err != nil {
+			link.Client.Logger.Errorf("Failed to deserialize link event: %v", err)
+			continue
+		}
+
+		handleLinkEvent(server, link, &event)
+	}
+}
+
+// sendLinkBurst introduces every user we know about to a new link
+func sendLinkBurst(link *Link) {
+	server := link.Client.Server
+	origin := server.Config().ServerName
+
+	for _, client := range server.ClientList() {
+		sendUserEvent(link, origin, protocol.PacketIdJoin, client.Name)
+	}
+	for _, user := range server.RemoteUserList() {
+		if user.Link == link {
+			continue
+		}
+		sendUserEvent(link, user.Origin, protocol.PacketIdJoin, user.Name)
+	}
+}
+
+// unlinkServer removes a lost link, along with every user
+// that was reachable through it
+func unlinkServer(link *Link) {
+	server := link.Client.Server
+	link.Client.Close()
+	if !server.IsLinked(link) {
+		// The link was replaced by another one to the same server
+		server.RemoveLink(link)
+		return
+	}
+	broadcastNotice(server, "Lost the link to server '%s'", link.Name)
+
+	for _, user := range server.RemoveLink(link) {
+		broadcastRemoteUser(server, protocol.PacketIdQuit, user.DisplayName())
+
+		for _, other := range server.LinkList() {
+			sendUserEvent(other, user.Origin, protocol.PacketIdQuit, user.Name)
+		}
+	}
+}
+
+func handleLinkEvent(server *ChatServer, link *Link, event *protocol.LinkEvent) {
+	if event.Origin == server.Config().ServerName || !server.events.Add(event.Id) {
+		// We have seen this event before
+		return
+	}
+	if !validName(event.Origin) {
+		link.Client.Logger.Warningf("Dropped event from invalid server name %q", event.Origin)
+		return
+	}
+
+	switch event.PacketId {
+	case protocol.PacketIdJoin:
+		var user protocol.User
+		if err := user.FromBytes(event.Data); err != nil {
+			link.Client.Logger.Errorf("Failed to deserialize remote join: %v", err)
+			return
+		}
+		if !validName(user.Name) {
+			link.Client.Logger.Warningf("Dropped remote join of invalid nickname %q", user.Name)
+			return
+		}
+		if !addRemoteUser(server, link, user.Name, event.Origin) {
+			return
+		}
+		broadcastRemoteUser(server, protocol.PacketIdJoin, remoteName(user.Name, event.Origin))
+
+	case protocol.PacketIdQuit:
+		var user protocol.User
+		if err := user.FromBytes(event.Data); err != nil {
+			link.Client.Logger.Errorf("Failed to deserialize remote quit: %v", err)
+			return
+		}
+		if !removeRemoteUser(server, user.Name, event.Origin) {
+			return
+		}
+		broadcastRemoteUser(server, protocol.PacketIdQuit, remoteName(user.Name, event.Origin))
+
+	case protocol.PacketIdMessage:
+		var message protocol.Message
+		if err := message.FromBytes(event.Data); err != nil {
+			link.Client.Logger.Errorf("Failed to deserialize remote message: %v", err)
+			return
+		}
+		if !validName(message.Sender) {
+			link.Client.Logger.Warningf("Dropped remote message from invalid nickname %q", message.Sender)
+			return
+		}
+		if !allowedKind(message.Kind) {
+			// Notices are meant for the users of the other server only
+			link.Client.Logger.Warningf("Dropped remote message of kind %d", message.Kind)
+			return
+		}
+
+		// Linked servers may have other limits than we do
+		content, chatError := validateMessage(message.Content, server.Config())
+		if chatError != nil {
+			link.Client.Logger.Warningf("Dropped remote message: %s", chatError.Message)
+			return
+		}
+		message.Content = content
+		message.Sender = remoteName(message.Sender, event.Origin)
+		originId := message.Id
+		message.Id = 0
+		message.ParentId = 0
+
+		// Ids are assigned by every server on its own, so we remember
+		// the id of the origin, which later changes will refer to
+		if record := server.StoreRemoteMessage(message, event.Origin, originId); record != nil {
+			message.Id = record.Id
+		}
+
+		data, err := message.ToBytes()
+		if err != nil {
+			link.Client.Logger.Errorf("Failed to serialize remote message: %v", err)
+			return
+		}
+		server.Broadcast(&protocol.Packet{Id: protocol.PacketIdMessage, Data: data}, nil)
+
+	case protocol.PacketIdEditMessage:
+		var edit protocol.MessageEdit
+		if err := edit.FromBytes(event.Data); err != nil {
+			link.Client.Logger.Errorf("Failed to deserialize remote edit: %v", err)
+			return
+		}
+		content, chatError := validateMessage(edit.Content, server.Config())
+		if chatError != nil {
+			link.Client.Logger.Warningf("Dropped remote edit: %s", chatError.Message)
+			return
+		}
+		applyRemoteChange(server, link, event.Origin, edit.Id, history.KindEdit, content)
+
+	case protocol.PacketIdDeleteMessage:
+		var messageId protocol.MessageId
+		if err := messageId.FromBytes(event.Data); err != nil {
+			link.Client.Logger.Errorf("Failed to deserialize remote deletion: %v", err)
+			return
+		}
+		applyRemoteChange(server, link, event.Origin, messageId.Id, history.KindDelete, "")
+
+	default:
+		link.Client.Logger.Warningf("Unknown link event: %d", event.PacketId)
+		return
+	}
+
+	// Pass the event on to every other server
+	for _, other := range server.LinkList() {
+		if other == link {
+			continue
+		}
+		sendLinkEvent(other, event)
+	}
+}
+
+// applyRemoteChange applies an edit or deletion from the server
+// where the message was sent, which already checked that the
+// change was allowed. The event is passed on either way, since
+// other servers may know the message even if we don't.
+func applyRemoteChange(server *ChatServer, link *Link, origin string, originId uint64, kind history.RecordKind, content string) {
+	if server.History == nil {
+		return
+	}
+
+	id, ok := server.History.Find(origin, originId)
+	if !ok {
+		link.Client.Logger.Debugf("Ignored change of unknown message %d from '%s'", originId, origin)
+		return
+	}
+
+	records, err := server.History.Get(id)
+	if err != nil {
+		link.Client.Logger.Errorf("Failed to read message %d: %v", id, err)
+		return
+	}
+	if len(records) == 0 || records[0].Deleted {
+		return
+	}
+
+	if _, err := applyChange(server, records[0], records[0].Sender, kind, content); err != nil {
+		link.Client.Logger.Errorf("Failed to change message %d: %v", id, err)
+	}
+}
+
+func addRemoteUser(server *ChatServer, link *Link, name string, origin string) bool {
+	server.linksMutex.Lock()
+	defer server.linksMutex.Unlock()
+
+	user := &RemoteUser{Name: name, Origin: origin, Link: link}
+	if _, exists := server.remoteUsers[user.DisplayName()]; exists {
+		return false
+	}
+	server.remoteUsers[user.DisplayName()] = user
+	return true
+}
+
+func removeRemoteUser(server *ChatServer, name string, origin string) bool {
+	server.linksMutex.Lock()
+	defer server.linksMutex.Unlock()
+
+	displayName := remoteName(name, origin)
+	if _, exists := server.remoteUsers[displayName]; !exists {
+		return false
+	}
+	delete(server.remoteUsers, displayName)
+	return true
+}
+
+func broadcastRemoteUser(server *ChatServer, packetId protocol.PacketId, displayName string) {
+	user := protocol.User{Name: displayName}
+	data, err := user.ToBytes()
+	if err != nil {
+		server.Logger.Errorf("Failed to serialize remote user: %v", err)
+		return
+	}
+	server.Broadcast(&protocol.Packet{Id: packetId, Data: data}, nil)
+}
+
+// relayLocalEvent sends an event caused by a local user to all linked servers
+func relayLocalEvent(server *ChatServer, packetId protocol.PacketId, data []byte) {
+	links := server.LinkList()
+	if len(links) == 0 {
+		return
+	}
+
+	event := &protocol.LinkEvent{
+		Id:       newEventId(),
+		Origin:   server.Config().ServerName,
+		PacketId: packetId,
+		Data:     data,
+	}
+	server.events.Add(event.Id)
+
+	for _, link := range links {
+		sendLinkEvent(link, event)
+	}
+}
+
+func sendUserEvent(link *Link, origin string, packetId protocol.PacketId, name string) {
+	user := protocol.User{Name: name}
+	data, err := user.ToBytes()
+	if err != nil {
+		link.Client.Logger.Errorf("Failed to serialize user: %v", err)
+		return
+	}
+
+	event := &protocol.LinkEvent{
+		Id:       newEventId(),
+		Origin:   origin,
+		PacketId: packetId,
+		Data:     data,
+	}
+	link.Client.Server.events.Add(event.Id)
+	sendLinkEvent(link, event)
+}
+
+func sendLinkEvent(link *Link, event *protocol.LinkEvent) {
+	data, err := event.ToBytes()
+	if err != nil {
+		link.Client.Logger.Errorf("Failed to serialize link event: %v", err)
+		return
+	}
+
+	packet := &protocol.Packet{Id: protocol.PacketIdLinkEvent, Data: data}
+	if err := link.Client.SendPacket(packet); err != nil {
+		link.Client.Logger.Errorf("Failed to send link event: %v", err)
+	}
+}
+
+func newEventId() uint64 {
+	var id [8]byte
+	rand.Read(id[:])
+	return binary.LittleEndian.Uint64(id[:])
+}
+
+// eventCache remembers a fixed number of recent event ids
+type eventCache struct {
+	seen  map[uint64]struct{}
+	order []uint64
+	next  int
+	mutex sync.Mutex
+}
+
+func newEventCache(size int) *eventCache {
+	return &eventCache{
+		seen:  make(map[uint64]struct{}, size),
+		order: make([]uint64, size),
+	}
+}
+
+// Add remembers the id, returning false if it was already known
+func (cache *eventCache) Add(id uint64) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if _, exists := cache.seen[id]; exists {
+		return false
+	}
+
+	// Forget the oldest id once the cache is full
+	if len(cache.seen) >= len(cache.order) {
+		delete(cache.seen, cache.order[cache.next])
+	}
+
+	cache.order[cache.next] = id
+	cache.next = (cache.next + 1) % len(cache.order)
+	cache.seen[id] = struct{}{}
+	return true
+}
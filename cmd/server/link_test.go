@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+// recordingConn keeps a copy of every write, which
+// is a single packet for connections of the server
+type recordingConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+func (conn *recordingConn) Write(data []byte) (int, error) {
+	conn.writes = append(conn.writes, append([]byte(nil), data...))
+	return conn.Conn.Write(data)
+}
+
+func newLinkTestServer(name string, peers ...string) *ChatServer {
+	serverConfig := config.DefaultConfig()
+	serverConfig.ServerName = name
+	serverConfig.FederationEnabled = true
+	serverConfig.FederationPeers = peers
+	serverConfig.LinkSecret = "link secret"
+	return NewChatServer(serverConfig, nil)
+}
+
+func TestLinkHelloReplay(t *testing.T) {
+	accepting := newLinkTestServer("b", "a")
+	connecting := newLinkTestServer("a", "b")
+
+	serverConn, clientConn := net.Pipe()
+	go handleConnection(serverConn, accepting)
+
+	recorder := &recordingConn{Conn: clientConn}
+	if _, err := connectLink(NewClient(recorder, connecting)); err != nil {
+		t.Fatalf("Link setup failed: %v", err)
+	}
+	clientConn.Close()
+
+	// Wait for the first link to be gone, so that the replay
+	// isn't rejected for linking the same server twice
+	for deadline := time.Now().Add(time.Second); len(accepting.LinkList()) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Link was not removed after closing it")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Send the recorded challenge, nonce request and hello again
+	serverConn, attackerConn := net.Pipe()
+	defer attackerConn.Close()
+	go handleConnection(serverConn, accepting)
+	attackerConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := accepting.Config().SecretKey
+	var response *protocol.Packet
+
+	for i, data := range recorder.writes[:3] {
+		if _, err := attackerConn.Write(data); err != nil {
+			t.Fatalf("Replaying packet %d failed: %v", i+1, err)
+		}
+		packet, err := protocol.DeserializePacket(attackerConn, key)
+		if err != nil {
+			t.Fatalf("Reading response %d failed: %v", i+1, err)
+		}
+		response = packet
+	}
+
+	if response.Id != protocol.PacketIdError {
+		t.Fatalf("Replayed link hello was answered with packet %d, want an error", response.Id)
+	}
+	if len(accepting.LinkList()) != 0 {
+		t.Fatal("Replayed link hello was accepted")
+	}
+}
+
+// dialLink links two servers over a pipe, like maintainLink does
+func dialLink(t *testing.T, from *ChatServer, to *ChatServer) error {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	go handleConnection(serverConn, to)
+
+	link, err := connectLink(NewClient(clientConn, from))
+	if err != nil {
+		clientConn.Close()
+		return err
+	}
+	go serveLink(link)
+	return nil
+}
+
+func TestMutualPeers(t *testing.T) {
+	tests := []struct {
+		name  string
+		first string
+	}{
+		{"lower name dials first", "a"},
+		{"higher name dials first", "b"},
+	}
+
+	for _, test := range tests {
+		servers := map[string]*ChatServer{
+			"a": newLinkTestServer("a", "b"),
+			"b": newLinkTestServer("b", "a"),
+		}
+		second := "a"
+		if test.first == "a" {
+			second = "b"
+		}
+
+		if err := dialLink(t, servers[test.first], servers[second]); err != nil {
+			t.Fatalf("%s: first link failed: %v", test.name, err)
+		}
+		err := dialLink(t, servers[second], servers[test.first])
+
+		// The link dialed by the lower name is kept on both sides
+		if test.first == "a" && !errors.Is(err, errAlreadyLinked) {
+			t.Fatalf("%s: second link was not refused as a duplicate: %v", test.name, err)
+		}
+		if test.first == "b" && err != nil {
+			t.Fatalf("%s: second link failed: %v", test.name, err)
+		}
+
+		for name, server := range servers {
+			links := server.LinkList()
+			if len(links) != 1 {
+				t.Fatalf("%s: server '%s' has %d links, want 1", test.name, name, len(links))
+			}
+			if links[0].Outbound != (name == "a") {
+				t.Fatalf("%s: server '%s' kept the link dialed by the other server", test.name, name)
+			}
+		}
+	}
+}
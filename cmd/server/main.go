@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/proxyproto"
+	"github.com/Lekuruu/go-chat/internal/tcp"
+	"github.com/Lekuruu/go-chat/internal/transport"
 )
 
+// ShutdownTimeout is how long the server waits for
+// clients to disconnect before closing their connections
+const ShutdownTimeout = 5 * time.Second
+
 func main() {
 	var server *ChatServer
 	var serverConfig *config.Config
@@ -25,11 +38,94 @@ func main() {
 		fmt.Printf("Failed to read config file: %v\n", err)
 		return
 	}
+	if err := serverConfig.Validate(); err != nil {
+		fmt.Printf("Invalid config file: %v\n", err)
+		return
+	}
 
 	connectionHandler := func(conn net.Conn) { handleConnection(conn, server) }
-	server = NewChatServer(serverConfig.ServerHost, serverConfig.ServerPort, serverConfig.SecretKey, connectionHandler)
-	server.RequireEncryption = serverConfig.EncryptionEnabled
-	server.Run()
+	server = NewChatServer(serverConfig, connectionHandler)
+	server.RejectHandler = func(conn net.Conn, err error) { rejectConnection(conn, server, err) }
+
+	server.History, err = openHistory(serverConfig, server.pruneSearch)
+	if err != nil {
+		server.Logger.Errorf("Failed to open message history: %v", err)
+		return
+	}
+	defer server.CloseHistory()
+
+	if server.History != nil {
+		server.Search, err = buildSearchIndex(server.History)
+		if err != nil {
+			server.Logger.Errorf("Failed to build search index: %v", err)
+			return
+		}
+		server.Logger.Infof("Indexed %d messages for search", server.Search.Len())
+	}
+
+	// Parsed by Validate already, so this can't fail
+	trustedProxies, _ := proxyproto.ParseNetworks(serverConfig.TrustedProxies)
+	server.TrustedProxies = trustedProxies
+
+	if serverConfig.WebSocketAddress != "" {
+		// Browser clients speak the same protocol over websockets
+		gateway := server.AddGateway("websocket-gateway", serverConfig.WebSocketAddress, connectionHandler)
+		gateway.TrustedProxies = trustedProxies
+		gateway.RejectHandler = server.RejectHandler
+	}
+
+	if serverConfig.IRCAddress != "" {
+		ircHandler := func(conn net.Conn) { handleIRCConnection(conn, server) }
+		gateway := server.AddGateway("irc-gateway", serverConfig.IRCAddress, ircHandler)
+		gateway.TrustedProxies = trustedProxies
+		gateway.RejectHandler = rejectIRCConnection
+	}
+
+	if serverConfig.TLSEnabled {
+		tlsConfig, err := transport.ServerTLSConfig(serverConfig.TLSCertificate, serverConfig.TLSKey)
+		if err != nil {
+			server.Logger.Errorf("Failed to load TLS certificate: %v", err)
+			return
+		}
+		server.TLSConfig = tlsConfig
+		server.Logger.Infof("TLS enabled, certificate fingerprint: %s", transport.CertificateFingerprint(tlsConfig))
+	}
+
+	// Shut down gracefully on interrupt/termination signals
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Apply config changes on SIGHUP while running
+	go watchConfig(ctx, server, config.DefaultConfigFilename)
+
+	// Mark users as away once they stop doing anything
+	go watchIdle(ctx, server)
+
+	if serverConfig.FederationEnabled {
+		for _, peer := range serverConfig.FederationPeers {
+			go maintainLink(ctx, server, peer)
+		}
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Run() }()
+
+	select {
+	case err := <-errs:
+		if err != nil && !errors.Is(err, tcp.ErrServerClosed) {
+			server.Logger.Errorf("Server error: %v", err)
+		}
+		return
+	case <-ctx.Done():
+		stop()
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx, "Server is shutting down"); err != nil {
+		server.Logger.Errorf("Failed to shut down gracefully: %v", err)
+	}
 }
 
 func handleConnection(conn net.Conn, server *ChatServer) {
@@ -41,7 +137,7 @@ func handleConnection(conn net.Conn, server *ChatServer) {
 	// Authentication stage
 	for {
 		packet, err := client.ReadPacket()
-		if err != nil && err.Error() == "EOF" {
+		if err != nil && (err.Error() == "EOF" || errors.Is(err, net.ErrClosed)) {
 			client.Logger.Infof("Client disconnected")
 			return
 		}
@@ -62,15 +158,20 @@ func handleConnection(conn net.Conn, server *ChatServer) {
 		if client.IsAuthenticated {
 			break
 		}
+		if client.Link != nil {
+			// The other side is a server, not a user
+			serveLink(client.Link)
+			return
+		}
 	}
 
 	// Change logger name to client's username
 	client.Logger.Infof("Client authenticated with username: '%s'", client.Name)
 	client.Logger.SetName(client.Name)
 
-	// Add client to server map & remove on disconnect
-	server.Clients[client.Name] = client
-	defer delete(server.Clients, client.Name)
+	// Client was added to the server map during authentication,
+	// so we only need to remove it on disconnect
+	defer server.RemoveClient(client)
 
 	// Broadcast join
 	broadcastJoin(client)
@@ -79,7 +180,7 @@ func handleConnection(conn net.Conn, server *ChatServer) {
 	// Main communication loop
 	for {
 		packet, err := client.ReadPacket()
-		if err != nil && err.Error() == "EOF" {
+		if err != nil && (err.Error() == "EOF" || errors.Is(err, net.ErrClosed)) {
 			client.Logger.Infof("Client disconnected")
 			return
 		}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/sanitize"
+)
+
+const (
+	// IdleCheckInterval is how often clients are checked for inactivity
+	IdleCheckInterval = 30 * time.Second
+
+	// IdleAwayMessage is shown for users that were marked as away automatically
+	IdleAwayMessage = "Idle"
+
+	// MaxAwayMessageLength is the maximum number of characters in an away message
+	MaxAwayMessageLength = 100
+)
+
+// presenceState is what other users see of a client, and is shared
+// between the client's goroutine and the idle watcher
+type presenceState struct {
+	state      protocol.PresenceState
+	message    string
+	lastActive time.Time
+
+	// auto is set if the client was marked as away for being idle,
+	// which is undone as soon as the client does something again
+	auto bool
+}
+
+// Presence returns the current presence of the client
+func (c *Client) Presence() protocol.Presence {
+	c.presenceMutex.Lock()
+	defer c.presenceMutex.Unlock()
+
+	return protocol.Presence{
+		Name:    c.Name,
+		State:   c.presence.state,
+		Message: c.presence.message,
+	}
+}
+
+// IdleTime returns the time since the client was last active
+func (c *Client) IdleTime() time.Duration {
+	c.presenceMutex.Lock()
+	defer c.presenceMutex.Unlock()
+	return time.Since(c.presence.lastActive)
+}
+
+// active resets the idle time, and brings the user back if they were
+// marked as away for being idle. It reports whether that happened.
+func (p *presenceState) active(now time.Time) bool {
+	p.lastActive = now
+	if !p.auto {
+		return false
+	}
+	*p = presenceState{state: protocol.PresenceOnline, lastActive: now}
+	return true
+}
+
+// idle marks an online user as away, once they have been inactive
+// for the given duration, and reports whether that happened
+func (p *presenceState) idle(now time.Time, after time.Duration) bool {
+	if p.state != protocol.PresenceOnline || now.Sub(p.lastActive) < after {
+		return false
+	}
+	p.state = protocol.PresenceAway
+	p.message = IdleAwayMessage
+	p.auto = true
+	return true
+}
+
+// set replaces the presence with one chosen by the user,
+// which also replaces an away state set for being idle
+func (p *presenceState) set(state protocol.PresenceState, message string) {
+	p.state = state
+	p.message = message
+	p.auto = false
+}
+
+// markActive resets the idle time of the client, and brings it back
+// if it was idle before. Only messages, edits and reactions count as
+// activity, since clients send other packets on their own.
+func (c *Client) markActive() {
+	c.presenceMutex.Lock()
+	returned := c.presence.active(time.Now())
+	c.presenceMutex.Unlock()
+
+	if returned {
+		broadcastPresence(c)
+	}
+}
+
+// markIdle sets the client away, if it is online and has
+// been inactive for the given duration
+func (c *Client) markIdle(after time.Duration) bool {
+	c.presenceMutex.Lock()
+	defer c.presenceMutex.Unlock()
+	return c.presence.idle(time.Now(), after)
+}
+
+func handlePresence(packet *protocol.Packet, client *Client) {
+	var presence protocol.Presence
+
+	if err := presence.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize presence: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	if presence.State > protocol.PresenceDoNotDisturb {
+		client.Logger.Warningf("Invalid presence state: %d", presence.State)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	message, chatError := validateAwayMessage(presence.Message)
+	if chatError != nil {
+		client.SendError(chatError)
+		return
+	}
+	if presence.State == protocol.PresenceOnline {
+		message = ""
+	}
+
+	client.presenceMutex.Lock()
+	client.presence.set(presence.State, message)
+	client.presenceMutex.Unlock()
+
+	broadcastPresence(client)
+}
+
+// validateAwayMessage returns the away message on a single line,
+// without any control sequences
+func validateAwayMessage(message string) (string, *ChatError) {
+	if !utf8.ValidString(message) {
+		return "", ErrInvalidEncoding
+	}
+
+	message = strings.Join(strings.Fields(sanitize.StripControl(message)), " ")
+	if utf8.RuneCountInString(message) > MaxAwayMessageLength {
+		return "", ErrAwayMessageTooLong
+	}
+	return message, nil
+}
+
+func presencePacket(client *Client) (*protocol.Packet, error) {
+	presence := client.Presence()
+	data, err := presence.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.Packet{
+		Id:   protocol.PacketIdPresence,
+		Data: data,
+	}, nil
+}
+
+// broadcastPresence tells every local user about the presence of
+// the client, including the client itself. Presence is not relayed
+// to linked servers.
+func broadcastPresence(client *Client) {
+	packet, err := presencePacket(client)
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize presence: %v", err)
+		return
+	}
+	client.Server.Broadcast(packet, nil)
+}
+
+// sendPresences tells a client that just joined about every
+// user who isn't simply online
+func sendPresences(client *Client) {
+	for _, user := range client.Server.ClientList() {
+		if user == client || user.Presence().State == protocol.PresenceOnline {
+			continue
+		}
+
+		packet, err := presencePacket(user)
+		if err != nil {
+			client.Logger.Errorf("Failed to serialize presence: %v", err)
+			continue
+		}
+		if err := client.SendPacket(packet); err != nil {
+			client.Logger.Errorf("Failed to send presence: %v", err)
+		}
+	}
+}
+
+// watchIdle marks clients as away, once they have been inactive
+// for the configured time. It blocks until the context is cancelled.
+func watchIdle(ctx context.Context, server *ChatServer) {
+	ticker := time.NewTicker(IdleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		minutes := server.Config().IdleAwayMinutes
+		if minutes <= 0 {
+			continue
+		}
+
+		for _, client := range server.ClientList() {
+			if client.markIdle(time.Duration(minutes) * time.Minute) {
+				client.Logger.Info("Marked client as away for being idle")
+				broadcastPresence(client)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+func TestPresenceTransitions(t *testing.T) {
+	const after = 10 * time.Minute
+
+	// Each step either waits, marks the user as active, checks for
+	// idleness or sets a presence, and reports whether it changed
+	// the presence in a way that is broadcast
+	type step struct {
+		wait    time.Duration
+		active  bool
+		idle    bool
+		set     *protocol.PresenceState
+		changed bool
+	}
+	away := protocol.PresenceAway
+	online := protocol.PresenceOnline
+
+	tests := []struct {
+		name    string
+		steps   []step
+		state   protocol.PresenceState
+		message string
+	}{
+		{
+			name:  "stays online while active",
+			steps: []step{{wait: after / 2}, {active: true}, {wait: after / 2}, {idle: true}},
+			state: protocol.PresenceOnline,
+		},
+		{
+			name:    "goes idle",
+			steps:   []step{{wait: after}, {idle: true, changed: true}, {idle: true}},
+			state:   protocol.PresenceAway,
+			message: IdleAwayMessage,
+		},
+		{
+			name:  "returns from idle",
+			steps: []step{{wait: after}, {idle: true, changed: true}, {active: true, changed: true}, {active: true}},
+			state: protocol.PresenceOnline,
+		},
+		{
+			name:    "explicit away is kept while active",
+			steps:   []step{{set: &away, changed: true}, {active: true}, {wait: after}, {idle: true}},
+			state:   protocol.PresenceAway,
+			message: "lunch",
+		},
+		{
+			name:    "explicit away replaces idle",
+			steps:   []step{{wait: after}, {idle: true, changed: true}, {set: &away, changed: true}, {active: true}},
+			state:   protocol.PresenceAway,
+			message: "lunch",
+		},
+		{
+			name:  "explicit online replaces idle",
+			steps: []step{{wait: after}, {idle: true, changed: true}, {set: &online, changed: true}, {active: true}},
+			state: protocol.PresenceOnline,
+		},
+	}
+
+	for _, test := range tests {
+		now := time.Now()
+		presence := presenceState{lastActive: now}
+
+		for i, step := range test.steps {
+			now = now.Add(step.wait)
+			changed := false
+
+			switch {
+			case step.active:
+				changed = presence.active(now)
+			case step.idle:
+				changed = presence.idle(now, after)
+			case step.set != nil:
+				message := ""
+				if *step.set != protocol.PresenceOnline {
+					message = "lunch"
+				}
+				presence.set(*step.set, message)
+				changed = true
+			}
+
+			if changed != step.changed {
+				t.Fatalf("%s: step %d changed the presence: %v, want %v", test.name, i+1, changed, step.changed)
+			}
+		}
+
+		if presence.state != test.state || presence.message != test.message {
+			t.Fatalf("%s: presence is %d %q, want %d %q", test.name, presence.state, presence.message, test.state, test.message)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Lekuruu/go-chat/internal/history"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+// MaxReactions is the number of different emoji a message can have
+const MaxReactions = 20
+
+// MaxEmojiSize is the maximum size of a reaction in bytes, which
+// leaves room for emoji that are made of several code points
+const MaxEmojiSize = 32
+
+// handleReaction adds the reaction of the client to a message,
+// or removes it if the client reacted with the same emoji before
+func handleReaction(packet *protocol.Packet, client *Client) {
+	var reaction protocol.MessageReaction
+
+	if err := reaction.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize reaction: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+	client.markActive()
+
+	if client.allowMessage() != nil {
+		return
+	}
+
+	if !validReaction(reaction.Emoji) {
+		client.Logger.Warningf("Rejected reaction: %q", reaction.Emoji)
+		client.SendError(ErrInvalidReaction)
+		return
+	}
+
+	message, ok := toggleReaction(client, reaction)
+	if !ok {
+		return
+	}
+
+	update := protocol.MessageReactions{
+		Id:        message.Id,
+		Reactions: protocolReactions(message.Reactions),
+	}
+	packet, err := messagePacket(protocol.PacketIdReactions, &update)
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize reactions: %v", err)
+		return
+	}
+
+	client.Server.Broadcast(packet, nil)
+}
+
+// toggleReaction stores the reaction of the client, or its removal,
+// and returns the message with all of its reactions. The reactions
+// are locked meanwhile, so that concurrent reactions of different
+// clients can't exceed the limit together.
+func toggleReaction(client *Client, reaction protocol.MessageReaction) (*history.Record, bool) {
+	server := client.Server
+	server.reactionsMutex.Lock()
+	defer server.reactionsMutex.Unlock()
+
+	message, ok := getMessage(client, reaction.Id)
+	if !ok {
+		return nil, false
+	}
+
+	kind := history.KindReact
+	index := slices.IndexFunc(message.Reactions, func(r history.Reaction) bool { return r.Emoji == reaction.Emoji })
+
+	switch {
+	case index >= 0 && slices.Contains(message.Reactions[index].Users, client.Name):
+		kind = history.KindUnreact
+	case index < 0 && len(message.Reactions) >= MaxReactions:
+		client.SendError(ErrTooManyReactions)
+		return nil, false
+	}
+
+	change := &history.Record{
+		Timestamp: time.Now(),
+		Sender:    client.Name,
+		Content:   reaction.Emoji,
+		Kind:      kind,
+		Target:    reaction.Id,
+	}
+	if err := server.History.Append(change); err != nil {
+		client.Logger.Errorf("Failed to store reaction to message %d: %v", reaction.Id, err)
+		return nil, false
+	}
+
+	// Read the message again, to get all of its reactions
+	return getMessage(client, reaction.Id)
+}
+
+// validReaction reports whether the emoji is short enough, and
+// contains neither whitespace nor control characters
+func validReaction(emoji string) bool {
+	if emoji == "" || len(emoji) > MaxEmojiSize || !utf8.ValidString(emoji) {
+		return false
+	}
+	return !strings.ContainsFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
+
+func protocolReactions(reactions []history.Reaction) []protocol.Reaction {
+	converted := make([]protocol.Reaction, 0, len(reactions))
+	for _, reaction := range reactions {
+		converted = append(converted, protocol.Reaction{
+			Emoji: reaction.Emoji,
+			Users: reaction.Users,
+		})
+	}
+	return converted
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/config"
+)
+
+// ConfigPollInterval is how often the config file is checked
+// for modifications, if "reload_on_change" is enabled
+const ConfigPollInterval = 2 * time.Second
+
+// restartSettings contains settings which are only used
+// on startup, and therefore can't be changed at runtime
+var restartSettings = map[string]bool{
+	"server_host":          true,
+	"server_port":          true,
+	"server_address":       true,
+	"websocket_address":    true,
+	"irc_address":          true,
+	"tls_enabled":          true,
+	"tls_certificate":      true,
+	"tls_key":              true,
+	"server_name":          true,
+	"federation_enabled":   true,
+	"federation_peers":     true,
+	"link_secret":          true,
+	"trusted_proxies":      true,
+	"history_path":         true,
+	"history_segment_size": true,
+	"history_max_size":     true,
+	"history_max_age_days": true,
+}
+
+// watchConfig reloads the configuration whenever the process receives
+// SIGHUP, or when the config file was modified and "reload_on_change"
+// is enabled. It blocks until the context is cancelled.
+func watchConfig(ctx context.Context, server *ChatServer, path string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(ConfigPollInterval)
+	defer ticker.Stop()
+	lastModified := modificationTime(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			server.Logger.Info("Received SIGHUP, reloading configuration ...")
+		case <-ticker.C:
+			if !server.Config().ReloadOnChange {
+				continue
+			}
+			modified := modificationTime(path)
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			server.Logger.Info("Configuration file changed, reloading ...")
+		}
+
+		if err := reloadConfig(server, path); err != nil {
+			server.Logger.Errorf("Failed to reload configuration: %v", err)
+		}
+	}
+}
+
+// reloadConfig reads & validates the config file, and applies
+// every setting that can be changed without a restart
+func reloadConfig(server *ChatServer, path string) error {
+	updated, err := config.ReadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := updated.Validate(); err != nil {
+		return err
+	}
+
+	current := server.Config()
+	changes := current.Changes(updated)
+
+	if len(changes) == 0 {
+		server.Logger.Info("Configuration reloaded, nothing changed")
+		return nil
+	}
+
+	for _, name := range changes {
+		if restartSettings[name] {
+			server.Logger.Warningf("Setting '%s' changed, but requires a restart to take effect", name)
+			continue
+		}
+		server.Logger.Infof("Setting '%s' changed", name)
+	}
+
+	// Keep reporting the settings that are actually in use
+	updated.Keep(current, restartSettings)
+
+	server.SetConfig(updated)
+	return nil
+}
+
+func modificationTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
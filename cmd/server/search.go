@@ -0,0 +1,145 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/history"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/search"
+)
+
+// SearchResultLimit is the maximum number of results per search
+const SearchResultLimit = 50
+
+// SearchContextSize is the number of messages sent before
+// and after a search result, when a client asks for its context
+const SearchContextSize = 10
+
+// buildSearchIndex indexes every message in the history
+func buildSearchIndex(store history.Store) (*search.Index, error) {
+	index := search.NewIndex()
+
+	err := store.Scan(func(record *history.Record) bool {
+		if !record.Deleted {
+			index.Add(record.Id, record.Sender, record.Timestamp, record.Content)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// pruneSearch removes the messages that retention
+// deleted from the history from the search index
+func (server *ChatServer) pruneSearch(firstId uint64) {
+	if server.Search != nil {
+		server.Search.RemoveBefore(firstId)
+	}
+}
+
+// handleSearch answers with the newest messages matching the query
+func handleSearch(packet *protocol.Packet, client *Client) {
+	var query protocol.SearchQuery
+
+	if err := query.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize search query: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	if !client.allowQuery() {
+		return
+	}
+
+	server := client.Server
+	if server.History == nil || server.Search == nil {
+		sendSearchPacket(client, protocol.PacketIdSearchResults, nil)
+		return
+	}
+
+	searchQuery := search.Query{
+		Words:  strings.Fields(query.Text),
+		Sender: query.Sender,
+	}
+	if query.After != 0 {
+		searchQuery.After = time.UnixMilli(query.After)
+	}
+	if query.Before != 0 {
+		searchQuery.Before = time.UnixMilli(query.Before)
+	}
+
+	limit := min(max(int(query.Limit), 1), SearchResultLimit)
+	ids := server.Search.Search(searchQuery, limit)
+
+	records, err := server.History.Get(ids...)
+	if err != nil {
+		client.Logger.Errorf("Failed to read search results: %v", err)
+		return
+	}
+
+	// Show the most recent results first
+	slices.Reverse(records)
+	sendSearchPacket(client, protocol.PacketIdSearchResults, records)
+}
+
+// handleSearchContext answers with the messages surrounding a search result
+func handleSearchContext(packet *protocol.Packet, client *Client) {
+	var messageId protocol.MessageId
+
+	if err := messageId.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message id: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	if !client.allowQuery() {
+		return
+	}
+
+	store := client.Server.History
+	if store == nil {
+		sendSearchPacket(client, protocol.PacketIdSearchContext, nil)
+		return
+	}
+
+	before, err := store.Before(messageId.Id, SearchContextSize)
+	if err != nil {
+		client.Logger.Errorf("Failed to read message context: %v", err)
+		return
+	}
+	message, err := store.Get(messageId.Id)
+	if err != nil {
+		client.Logger.Errorf("Failed to read message context: %v", err)
+		return
+	}
+	after, err := store.After(messageId.Id, SearchContextSize)
+	if err != nil {
+		client.Logger.Errorf("Failed to read message context: %v", err)
+		return
+	}
+
+	records := slices.Concat(before, message, after)
+	sendSearchPacket(client, protocol.PacketIdSearchContext, records)
+}
+
+func sendSearchPacket(client *Client, packetId protocol.PacketId, records []*history.Record) {
+	batch := historyBatch(records)
+	data, err := batch.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize search results: %v", err)
+		return
+	}
+
+	packet := &protocol.Packet{
+		Id:   packetId,
+		Data: data,
+	}
+
+	if err := client.SendPacket(packet); err != nil {
+		client.Logger.Errorf("Failed to send search results: %v", err)
+	}
+}
@@ -1,28 +1,201 @@
 package main
 
 import (
+	"context"
 	"net"
+	"sync"
 
+	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/history"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/search"
 	"github.com/Lekuruu/go-chat/internal/tcp"
 )
 
 type ChatServer struct {
 	*tcp.Server
-	Clients           map[string]*Client
-	EncryptionKey     []byte
-	Version           uint8
-	RequireEncryption bool
+	Clients map[string]*Client
+	Version uint8
+
+	// Gateways are additional listeners, e.g. for websocket
+	// clients, which share the client registry of this server
+	Gateways []*tcp.Server
+
+	// History stores all messages, and is nil if disabled
+	History history.Store
+	Search  *search.Index
+
+	// Linked servers & the users we know about through them
+	links       map[string]*Link
+	remoteUsers map[string]*RemoteUser
+	events      *eventCache
+
+	// linkRemoved is closed & replaced whenever a link is removed
+	linkRemoved chan struct{}
+
+	config       *config.Config
+	configMutex  sync.RWMutex
+	clientsMutex sync.RWMutex
+	linksMutex   sync.RWMutex
+
+	// reactionsMutex is held while a reaction is checked against
+	// the current reactions of a message and stored
+	reactionsMutex sync.Mutex
 }
 
-func NewChatServer(host string, port int, key []byte, handler func(net.Conn)) *ChatServer {
+func NewChatServer(serverConfig *config.Config, handler func(net.Conn)) *ChatServer {
 	// Create base server from tcp package
-	tcpServer := tcp.NewServer("chat-server", host, port, handler)
+	tcpServer := tcp.NewServer("chat-server", serverConfig.ServerHost, serverConfig.ServerPort, handler)
+	tcpServer.Endpoint = serverConfig.ServerAddress
+	tcpServer.Limiter = tcp.NewLimiter(connectionLimits(serverConfig))
 
 	return &ChatServer{
-		Clients:           make(map[string]*Client),
-		Server:            tcpServer,
-		EncryptionKey:     key,
-		RequireEncryption: true,
-		Version:           1,
+		Clients:     make(map[string]*Client),
+		Server:      tcpServer,
+		Version:     1,
+		links:       make(map[string]*Link),
+		remoteUsers: make(map[string]*RemoteUser),
+		events:      newEventCache(EventCacheSize),
+		linkRemoved: make(chan struct{}),
+		config:      serverConfig,
 	}
 }
+
+// Config returns the currently active configuration.
+// The returned value must not be modified, since it
+// may be shared with other goroutines.
+func (server *ChatServer) Config() *config.Config {
+	server.configMutex.RLock()
+	defer server.configMutex.RUnlock()
+	return server.config
+}
+
+// SetConfig replaces the active configuration. Settings that
+// are read on demand take effect immediately, while settings
+// used to set up the listener only apply after a restart.
+func (server *ChatServer) SetConfig(serverConfig *config.Config) {
+	server.configMutex.Lock()
+	defer server.configMutex.Unlock()
+	server.config = serverConfig
+	server.Limiter.SetLimits(connectionLimits(serverConfig))
+}
+
+// AddClient registers a client under its name, returning
+// false if the name is already taken by another client
+func (server *ChatServer) AddClient(client *Client) bool {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	if existing, ok := server.Clients[client.Name]; ok && existing != client {
+		return false
+	}
+	server.Clients[client.Name] = client
+	return true
+}
+
+func (server *ChatServer) RemoveClient(client *Client) {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	if server.Clients[client.Name] == client {
+		delete(server.Clients, client.Name)
+	}
+}
+
+func (server *ChatServer) GetClient(name string) (*Client, bool) {
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+	client, ok := server.Clients[name]
+	return client, ok
+}
+
+// ClientList returns a snapshot of all connected clients,
+// which is safe to iterate over while clients join or leave
+func (server *ChatServer) ClientList() []*Client {
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+
+	clients := make([]*Client, 0, len(server.Clients))
+	for _, client := range server.Clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// AddGateway creates an additional listener on the given endpoint,
+// which is started & stopped together with the main server
+func (server *ChatServer) AddGateway(name string, endpoint string, handler func(net.Conn)) *tcp.Server {
+	gateway := tcp.NewServer(name, "", 0, handler)
+	gateway.Endpoint = endpoint
+	gateway.Limiter = server.Limiter // The limits apply to all listeners combined
+	gateway.Logger.SetLevel(server.Logger.GetLevel())
+	server.Gateways = append(server.Gateways, gateway)
+	return gateway
+}
+
+// Run starts the main server and all gateways, and returns
+// as soon as one of them stops
+func (server *ChatServer) Run() error {
+	errs := make(chan error, len(server.Gateways)+1)
+
+	for _, gateway := range server.Gateways {
+		go func() { errs <- gateway.Run() }()
+	}
+	go func() { errs <- server.Server.Run() }()
+
+	return <-errs
+}
+
+// UserNames returns the names of all local users, as well
+// as the users of linked servers
+func (server *ChatServer) UserNames() []string {
+	clients := server.ClientList()
+	remoteUsers := server.RemoteUserList()
+
+	names := make([]string, 0, len(clients)+len(remoteUsers))
+	for _, client := range clients {
+		names = append(names, client.Name)
+	}
+	for _, user := range remoteUsers {
+		names = append(names, user.DisplayName())
+	}
+	return names
+}
+
+// Broadcast sends a packet to every local client, except for the given one
+func (server *ChatServer) Broadcast(packet *protocol.Packet, except *Client) {
+	for _, targetClient := range server.ClientList() {
+		if targetClient == except {
+			continue
+		}
+		if err := targetClient.SendPacket(packet); err != nil {
+			targetClient.Logger.Errorf("Failed to send packet %d: %v", packet.Id, err)
+		}
+	}
+}
+
+// Shutdown stops accepting connections, notifies every connected
+// client with the given reason and waits for them to disconnect,
+// until the context expires.
+func (server *ChatServer) Shutdown(ctx context.Context, reason string) error {
+	var gateways sync.WaitGroup
+
+	for _, gateway := range server.Gateways {
+		gateways.Add(1)
+		go func() {
+			defer gateways.Done()
+			gateway.Shutdown(ctx)
+		}()
+	}
+
+	// Gateway clients are part of the same registry,
+	// so they are notified by the main server as well
+	server.RegisterOnShutdown(func(ctx context.Context) {
+		broadcastShutdown(server, ctx, reason)
+		server.CloseLinks()
+	})
+	err := server.Server.Shutdown(ctx)
+
+	gateways.Wait()
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import "github.com/Lekuruu/go-chat/internal/protocol"
+
+// ThreadSize is the maximum number of replies sent for a thread
+const ThreadSize = 200
+
+// threadRoot returns the id of the message starting the thread that
+// the given message belongs to, since replies to replies are kept
+// in the same thread
+func threadRoot(client *Client, id uint64) (uint64, bool) {
+	message, ok := getMessage(client, id)
+	if !ok {
+		return 0, false
+	}
+	if message.Parent != 0 {
+		return message.Parent, true
+	}
+	return message.Id, true
+}
+
+// handleThreadRequest answers with the message starting
+// the thread, followed by all of its replies
+func handleThreadRequest(packet *protocol.Packet, client *Client) {
+	var messageId protocol.MessageId
+
+	if err := messageId.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize message id: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	if !client.allowQuery() {
+		return
+	}
+
+	rootId, ok := threadRoot(client, messageId.Id)
+	if !ok {
+		return
+	}
+
+	store := client.Server.History
+	root, err := store.Get(rootId)
+	if err != nil {
+		client.Logger.Errorf("Failed to read thread %d: %v", rootId, err)
+		return
+	}
+	replies, err := store.Replies(rootId, ThreadSize)
+	if err != nil {
+		client.Logger.Errorf("Failed to read thread %d: %v", rootId, err)
+		return
+	}
+
+	batch := historyBatch(append(root, replies...))
+	data, err := batch.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize thread: %v", err)
+		return
+	}
+
+	packet = &protocol.Packet{
+		Id:   protocol.PacketIdThread,
+		Data: data,
+	}
+
+	if err := client.SendPacket(packet); err != nil {
+		client.Logger.Errorf("Failed to send thread: %v", err)
+	}
+}
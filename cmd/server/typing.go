@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+)
+
+// TypingRate is the minimum time between two typing notifications
+// of a client, that are relayed to the other users
+const TypingRate = time.Second
+
+// handleTyping relays the typing state of a client to everyone else.
+// Clients repeat it while typing, so notifications that arrive too
+// quickly are dropped instead of being treated as flooding.
+func handleTyping(packet *protocol.Packet, client *Client) {
+	var typing protocol.Typing
+
+	if err := typing.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize typing state: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	now := time.Now()
+	if typing.Active && now.Sub(client.lastTyping) < TypingRate {
+		return
+	}
+	client.lastTyping = now
+
+	// Clients may only type in their own name
+	typing.Name = client.Name
+
+	data, err := typing.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize typing state: %v", err)
+		return
+	}
+
+	client.Server.Broadcast(&protocol.Packet{
+		Id:   protocol.PacketIdTyping,
+		Data: data,
+	}, client)
+}
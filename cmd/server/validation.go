@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Lekuruu/go-chat/internal/config"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/sanitize"
+)
+
+// allowedKind reports whether users may send messages of the given
+// kind. Notices & system messages can only be sent by the server.
+func allowedKind(kind protocol.MessageKind) bool {
+	return kind == protocol.MessageKindNormal || kind == protocol.MessageKindAction
+}
+
+// validName checks a nickname or server name, which must not be empty
+// or contain control sequences, line breaks or the '@', since that is
+// reserved for users of linked servers
+func validName(name string) bool {
+	if name == "" || !utf8.ValidString(name) {
+		return false
+	}
+	return !strings.ContainsAny(name, "@\n\t") && !sanitize.HasControl(name)
+}
+
+// validateMessage checks the content of a message against the
+// configured rules, and returns the content to broadcast instead
+func validateMessage(content string, serverConfig *config.Config) (string, *ChatError) {
+	if !utf8.ValidString(content) {
+		return "", ErrInvalidEncoding
+	}
+
+	if sanitize.HasControl(content) {
+		if !serverConfig.StripControlSequences {
+			return "", ErrControlSequence
+		}
+		content = sanitize.StripControl(content)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return "", ErrEmptyMessage
+	}
+
+	if serverConfig.MaxMessageLength > 0 && utf8.RuneCountInString(content) > serverConfig.MaxMessageLength {
+		return "", ErrMessageTooLong
+	}
+	return content, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"alice", true},
+		{"Zoë", true},
+		{"", false},
+		{"alice@other", false},
+		{"\x1b[2J", false},
+		{"alice\x1b]0;title\x07", false},
+		{"ali\u009bce", false},
+		{"alice\nbob", false},
+		{"alice\tbob", false},
+		{"\xff", false},
+	}
+
+	for _, test := range tests {
+		if valid := validName(test.name); valid != test.valid {
+			t.Fatalf("validName(%q) = %v, want %v", test.name, valid, test.valid)
+		}
+	}
+}
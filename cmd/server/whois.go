@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/sanitize"
+)
+
+// MaxSoftwareLength is the maximum length of the client software,
+// which is shown to other users when they look the client up
+const MaxSoftwareLength = 64
+
+// handleWhois answers with information about a local user
+func handleWhois(packet *protocol.Packet, client *Client) {
+	var name protocol.String
+
+	if err := name.FromBytes(packet.Data); err != nil {
+		client.Logger.Errorf("Failed to deserialize whois request: %v", err)
+		client.SendError(ErrInvalidPacket)
+		return
+	}
+
+	// Users of linked servers are not included,
+	// since we don't know about their connection
+	target, ok := client.Server.GetClient(name.Value)
+	if !ok {
+		client.SendError(ErrNoSuchUser)
+		return
+	}
+
+	info := whoisInfo(target)
+	data, err := info.ToBytes()
+	if err != nil {
+		client.Logger.Errorf("Failed to serialize whois reply: %v", err)
+		return
+	}
+
+	packet = &protocol.Packet{
+		Id:   protocol.PacketIdWhoisReply,
+		Data: data,
+	}
+
+	if err := client.SendPacket(packet); err != nil {
+		client.Logger.Errorf("Failed to send whois reply: %v", err)
+	}
+}
+
+func whoisInfo(client *Client) protocol.WhoisInfo {
+	presence := client.Presence()
+
+	return protocol.WhoisInfo{
+		Name:        client.Name,
+		ConnectedAt: client.ConnectedAt.UnixMilli(),
+		Idle:        client.IdleTime().Milliseconds(),
+		State:       presence.State,
+		AwayMessage: presence.Message,
+		Client:      clientDescription(client),
+		Encrypted:   client.Encryption != protocol.EncryptionTypeNone,
+	}
+}
+
+// clientSoftware returns the software a client sent with its
+// nickname on a single line, without any control sequences
+func clientSoftware(software string) string {
+	software = strings.ToValidUTF8(software, "")
+	software = strings.Join(strings.Fields(sanitize.StripControl(software)), " ")
+
+	if runes := []rune(software); len(runes) > MaxSoftwareLength {
+		return string(runes[:MaxSoftwareLength])
+	}
+	return software
+}
+
+// clientDescription returns the software the client uses,
+// if it told us, along with the protocol it speaks
+func clientDescription(client *Client) string {
+	if _, ok := client.Frontend.(*IRCSession); ok {
+		return "IRC"
+	}
+	if client.Software == "" {
+		return fmt.Sprintf("ECP v%d", client.Version)
+	}
+	return fmt.Sprintf("%s (ECP v%d)", client.Software, client.Version)
+}
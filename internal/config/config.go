@@ -2,18 +2,55 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
+
+	"github.com/Lekuruu/go-chat/internal/proxyproto"
+	"github.com/Lekuruu/go-chat/internal/transport"
 )
 
 type Config struct {
-	EncryptionEnabled bool   `json:"encryption_enabled"`
-	ServerHost        string `json:"server_host"`
-	ServerPort        int    `json:"server_port"`
-	SecretKey         []byte `json:"secret_key"`
+	EncryptionEnabled     bool     `json:"encryption_enabled"`
+	ServerHost            string   `json:"server_host"`
+	ServerPort            int      `json:"server_port"`
+	ServerAddress         string   `json:"server_address"`
+	WebSocketAddress      string   `json:"websocket_address"`
+	IRCAddress            string   `json:"irc_address"`
+	SecretKey             []byte   `json:"secret_key"`
+	ReloadOnChange        bool     `json:"reload_on_change"`
+	TLSEnabled            bool     `json:"tls_enabled"`
+	TLSCertificate        string   `json:"tls_certificate"`
+	TLSKey                string   `json:"tls_key"`
+	TLSFingerprint        string   `json:"tls_fingerprint"`
+	ServerName            string   `json:"server_name"`
+	FederationEnabled     bool     `json:"federation_enabled"`
+	FederationPeers       []string `json:"federation_peers"`
+	LinkSecret            string   `json:"link_secret"`
+	TrustedProxies        []string `json:"trusted_proxies"`
+	MaxConnections        int      `json:"max_connections"`
+	MaxConnectionsPerIP   int      `json:"max_connections_per_ip"`
+	MaxConnectionRate     int      `json:"max_connection_rate"`
+	MessageRate           float64  `json:"message_rate"`
+	MessageBurst          int      `json:"message_burst"`
+	MaxMessageLength      int      `json:"max_message_length"`
+	StripControlSequences bool     `json:"strip_control_sequences"`
+	HistoryPath           string   `json:"history_path"`
+	HistorySegmentSize    int64    `json:"history_segment_size"`
+	HistoryMaxSize        int64    `json:"history_max_size"`
+	HistoryMaxAgeDays     int      `json:"history_max_age_days"`
+	HistoryReplay         int      `json:"history_replay"`
+	Moderators            []string `json:"moderators"`
+	IdleAwayMinutes       int      `json:"idle_away_minutes"`
 }
 
 const DefaultConfigFilename = "config.json"
 
+// MaxHistoryReplay is the largest number of messages sent to users
+// when they join, which matches the size of a history page
+const MaxHistoryReplay = 100
+
 func ReadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -31,10 +68,34 @@ func ReadConfig(path string) (*Config, error) {
 
 func DefaultConfig() *Config {
 	return &Config{
-		EncryptionEnabled: true,
-		ServerHost:        "localhost",
-		ServerPort:        8080,
-		SecretKey:         []byte("A0KWJW3qRCiYcEj3"),
+		EncryptionEnabled:     true,
+		ServerHost:            "localhost",
+		ServerPort:            8080,
+		ServerAddress:         "",
+		WebSocketAddress:      "",
+		IRCAddress:            "",
+		SecretKey:             []byte("A0KWJW3qRCiYcEj3"),
+		ReloadOnChange:        false,
+		TLSEnabled:            false,
+		ServerName:            "go-chat",
+		FederationEnabled:     false,
+		FederationPeers:       []string{},
+		LinkSecret:            "",
+		TrustedProxies:        []string{},
+		MaxConnections:        0,
+		MaxConnectionsPerIP:   0,
+		MaxConnectionRate:     0,
+		MessageRate:           1,
+		MessageBurst:          5,
+		MaxMessageLength:      500,
+		StripControlSequences: true,
+		HistoryPath:           "history",
+		HistorySegmentSize:    4 << 20,
+		HistoryMaxSize:        64 << 20,
+		HistoryMaxAgeDays:     0,
+		HistoryReplay:         50,
+		Moderators:            []string{},
+		IdleAwayMinutes:       10,
 	}
 }
 
@@ -55,3 +116,133 @@ func EnsureConfig(path string) (bool, error) {
 	}
 	return true, nil
 }
+
+// Validate checks the configuration for values that
+// would make the server or client fail at runtime
+func (c *Config) Validate() error {
+	switch len(c.SecretKey) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("secret_key must be 16, 24 or 32 bytes long, got %d", len(c.SecretKey))
+	}
+
+	if c.ServerPort < 0 || c.ServerPort > 65535 {
+		return fmt.Errorf("server_port must be between 0 and 65535, got %d", c.ServerPort)
+	}
+
+	if c.ServerAddress != "" {
+		if _, err := transport.ParseEndpoint(c.ServerAddress); err != nil {
+			return fmt.Errorf("invalid server_address: %w", err)
+		}
+	}
+
+	if c.WebSocketAddress != "" {
+		endpoint, err := transport.ParseEndpoint(c.WebSocketAddress)
+		if err != nil {
+			return fmt.Errorf("invalid websocket_address: %w", err)
+		}
+		if endpoint.Scheme != "ws" {
+			return fmt.Errorf("websocket_address must start with 'ws://', got '%s'", c.WebSocketAddress)
+		}
+	}
+
+	if c.IRCAddress != "" {
+		if _, err := transport.ParseEndpoint(c.IRCAddress); err != nil {
+			return fmt.Errorf("invalid irc_address: %w", err)
+		}
+	}
+
+	if c.TLSFingerprint != "" {
+		if _, err := transport.ParseFingerprint(c.TLSFingerprint); err != nil {
+			return fmt.Errorf("invalid tls_fingerprint: %w", err)
+		}
+	}
+
+	if strings.Contains(c.ServerName, "@") {
+		return fmt.Errorf("server_name must not contain '@', got '%s'", c.ServerName)
+	}
+
+	if c.FederationEnabled && c.ServerName == "" {
+		return fmt.Errorf("server_name is required when federation is enabled")
+	}
+
+	if c.FederationEnabled && c.LinkSecret == "" {
+		return fmt.Errorf("link_secret is required when federation is enabled")
+	}
+
+	for _, peer := range c.FederationPeers {
+		if _, err := transport.ParseEndpoint(peer); err != nil {
+			return fmt.Errorf("invalid federation peer '%s': %w", peer, err)
+		}
+	}
+
+	if _, err := proxyproto.ParseNetworks(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted_proxies: %w", err)
+	}
+
+	if c.MaxConnections < 0 || c.MaxConnectionsPerIP < 0 || c.MaxConnectionRate < 0 {
+		return fmt.Errorf("connection limits must not be negative")
+	}
+
+	if c.MessageRate < 0 {
+		return fmt.Errorf("message_rate must not be negative, got %g", c.MessageRate)
+	}
+
+	if c.MessageRate > 0 && c.MessageBurst < 1 {
+		return fmt.Errorf("message_burst must be at least 1, got %d", c.MessageBurst)
+	}
+
+	if c.MaxMessageLength < 0 {
+		return fmt.Errorf("max_message_length must not be negative, got %d", c.MaxMessageLength)
+	}
+
+	if c.HistorySegmentSize < 0 || c.HistoryMaxSize < 0 || c.HistoryMaxAgeDays < 0 || c.HistoryReplay < 0 {
+		return fmt.Errorf("history limits must not be negative")
+	}
+
+	if c.HistoryReplay > MaxHistoryReplay {
+		return fmt.Errorf("history_replay must be at most %d, got %d", MaxHistoryReplay, c.HistoryReplay)
+	}
+
+	if c.IdleAwayMinutes < 0 {
+		return fmt.Errorf("idle_away_minutes must not be negative, got %d", c.IdleAwayMinutes)
+	}
+	return nil
+}
+
+// Changes returns the json names of all settings
+// that differ between this and the other config
+func (c *Config) Changes(other *Config) []string {
+	current := reflect.ValueOf(c).Elem()
+	updated := reflect.ValueOf(other).Elem()
+	changes := make([]string, 0)
+
+	for i := 0; i < current.NumField(); i++ {
+		if reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+		changes = append(changes, fieldName(current.Type().Field(i)))
+	}
+	return changes
+}
+
+// Keep copies the settings with the given json names from
+// the other config, leaving all other settings untouched
+func (c *Config) Keep(other *Config, names map[string]bool) {
+	current := reflect.ValueOf(c).Elem()
+	previous := reflect.ValueOf(other).Elem()
+
+	for i := 0; i < current.NumField(); i++ {
+		if names[fieldName(current.Type().Field(i))] {
+			current.Field(i).Set(previous.Field(i))
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Default config is invalid: %v", err)
+	}
+
+	config.SecretKey = []byte("too short")
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected error for invalid key length")
+	}
+
+	config = DefaultConfig()
+	config.ServerAddress = "carrier-pigeon://home"
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected error for unsupported transport")
+	}
+
+	config = DefaultConfig()
+	config.TrustedProxies = []string{"10.0.0.0/33"}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected error for invalid trusted proxy")
+	}
+
+	config = DefaultConfig()
+	config.HistoryReplay = MaxHistoryReplay + 1
+	if err := config.Validate(); err == nil {
+		t.Fatal("Expected error for too large history replay")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	current := DefaultConfig()
+	updated := DefaultConfig()
+
+	if changes := current.Changes(updated); len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %v", changes)
+	}
+
+	updated.EncryptionEnabled = false
+	updated.SecretKey = []byte("0123456789abcdef")
+
+	changes := current.Changes(updated)
+	expected := []string{"encryption_enabled", "secret_key"}
+
+	if !slices.Equal(changes, expected) {
+		t.Fatalf("Changes returned %v, want %v", changes, expected)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	current := DefaultConfig()
+	updated := DefaultConfig()
+	updated.ServerName = "other"
+	updated.HistoryPath = "elsewhere"
+	updated.MessageRate = 5
+
+	updated.Keep(current, map[string]bool{"server_name": true, "history_path": true})
+
+	changes := current.Changes(updated)
+	expected := []string{"message_rate"}
+
+	if !slices.Equal(changes, expected) {
+		t.Fatalf("Keep failed: changes are %v, want %v", changes, expected)
+	}
+}
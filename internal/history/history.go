@@ -0,0 +1,210 @@
+// Package history stores chat messages, so they
+// can be replayed after they were broadcast.
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// RecordKind tells messages apart from the changes made to them
+type RecordKind uint8
+
+const (
+	KindMessage RecordKind = iota
+	KindEdit
+	KindDelete
+	KindReact
+	KindUnreact
+)
+
+// Reaction is an emoji, along with the users who reacted with it
+type Reaction struct {
+	Emoji string
+	Users []string
+}
+
+// Record is a single stored message, or a change to one
+type Record struct {
+	Id        uint64
+	Timestamp time.Time
+	Sender    string
+	Content   string
+
+	// Parent is the id of the message that starts the
+	// thread this message replies to, or zero otherwise
+	Parent uint64
+
+	// Action is set for messages describing what the
+	// sender does, which were sent with "/me"
+	Action bool
+
+	// Origin & OriginId identify messages that were relayed from
+	// a linked server, by its name and the id it assigned, so that
+	// later changes from that server can be applied to them
+	Origin   string
+	OriginId uint64
+
+	// Edits, deletions & reactions are stored as records of their own,
+	// which refer to the message they change. Stores apply them to their
+	// target when reading, and never return them by themselves. The
+	// content of reactions is the emoji.
+	Kind   RecordKind
+	Target uint64
+
+	// Edited, Deleted & Reactions describe the changes to a message.
+	// They are not stored, but derived from the change records.
+	Edited    bool
+	Deleted   bool
+	Reactions []Reaction
+}
+
+// Store is implemented by every history backend. All methods except
+// Append only return messages, with every change already applied.
+type Store interface {
+	// Append assigns the next id to the record and stores it
+	Append(record *Record) error
+
+	// Last returns up to n of the most recent records, oldest first
+	Last(n int) ([]*Record, error)
+
+	// Before returns up to n records older than the given id, oldest first
+	Before(id uint64, n int) ([]*Record, error)
+
+	// BeforeTime returns up to n records that were
+	// stored before the given time, oldest first
+	BeforeTime(timestamp time.Time, n int) ([]*Record, error)
+
+	// After returns up to n records newer than the given id, oldest first
+	After(id uint64, n int) ([]*Record, error)
+
+	// Get returns the records with the given ids, ordered
+	// by id, skipping records that no longer exist
+	Get(ids ...uint64) ([]*Record, error)
+
+	// Replies returns up to n of the oldest replies to a message
+	Replies(parent uint64, n int) ([]*Record, error)
+
+	// Scan calls the function for every record, oldest first,
+	// until the function returns false
+	Scan(fn func(*Record) bool) error
+
+	// Find returns the id of the message that was relayed from
+	// the given server, where it was stored with the origin id
+	Find(origin string, originId uint64) (uint64, bool)
+
+	Close() error
+}
+
+// recordVersion is written in front of every encoded
+// record, to allow changing the format later on. Version 1
+// records are messages without a kind & target, version
+// 2 records have no parent, version 3 records are
+// never actions and version 4 records have no origin.
+const recordVersion = 5
+
+var ErrUnknownVersion = errors.New("history: unknown record version")
+
+func encodeRecord(record *Record) []byte {
+	buffer := new(bytes.Buffer)
+	buffer.WriteByte(recordVersion)
+	binary.Write(buffer, binary.LittleEndian, record.Id)
+	binary.Write(buffer, binary.LittleEndian, record.Timestamp.UnixNano())
+	buffer.WriteByte(byte(record.Kind))
+	binary.Write(buffer, binary.LittleEndian, record.Target)
+	binary.Write(buffer, binary.LittleEndian, record.Parent)
+	binary.Write(buffer, binary.LittleEndian, record.Action)
+	writeString(buffer, record.Sender)
+	writeString(buffer, record.Content)
+	writeString(buffer, record.Origin)
+	binary.Write(buffer, binary.LittleEndian, record.OriginId)
+	return buffer.Bytes()
+}
+
+func decodeRecord(data []byte) (*Record, error) {
+	reader := bytes.NewReader(data)
+
+	version, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > recordVersion {
+		return nil, ErrUnknownVersion
+	}
+
+	record := &Record{}
+	var timestamp int64
+
+	if err := binary.Read(reader, binary.LittleEndian, &record.Id); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &timestamp); err != nil {
+		return nil, err
+	}
+	record.Timestamp = time.Unix(0, timestamp)
+
+	if version >= 2 {
+		kind, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		record.Kind = RecordKind(kind)
+
+		if err := binary.Read(reader, binary.LittleEndian, &record.Target); err != nil {
+			return nil, err
+		}
+	}
+
+	if version >= 3 {
+		if err := binary.Read(reader, binary.LittleEndian, &record.Parent); err != nil {
+			return nil, err
+		}
+	}
+
+	if version >= 4 {
+		if err := binary.Read(reader, binary.LittleEndian, &record.Action); err != nil {
+			return nil, err
+		}
+	}
+
+	if record.Sender, err = readString(reader); err != nil {
+		return nil, err
+	}
+	if record.Content, err = readString(reader); err != nil {
+		return nil, err
+	}
+
+	if version >= 5 {
+		if record.Origin, err = readString(reader); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &record.OriginId); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+func writeString(w io.Writer, v string) {
+	binary.Write(w, binary.LittleEndian, uint32(len(v)))
+	io.WriteString(w, v)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return "", err
+	}
+	if int64(length) > int64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
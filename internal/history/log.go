@@ -0,0 +1,813 @@
+package history
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// segmentExtension is the file extension of log segments, which
+// are named after the id of the first record they contain
+const segmentExtension = ".log"
+
+// frameHeaderSize is the size of the length & checksum,
+// which are written in front of every record
+const frameHeaderSize = 8
+
+// errDamagedRecord is returned when a record changed on
+// disk, after its position was added to the index
+var errDamagedRecord = errors.New("history: damaged record")
+
+// expireInterval is how often a log with an age limit checks for
+// expired records, which are otherwise only deleted on rotation
+const expireInterval = time.Hour
+
+// readChunkSize is the number of records read at once,
+// while looking for records matching a query
+const readChunkSize = 256
+
+// LogOptions control the size of a log, where
+// zero values disable the respective limit
+type LogOptions struct {
+	// SegmentSize is the size at which a new segment is started
+	SegmentSize int64
+
+	// MaxSize & MaxAge are the retention limits, after which the
+	// oldest segments are deleted. The active segment is only
+	// replaced once it expired, and is otherwise always kept.
+	MaxSize int64
+	MaxAge  time.Duration
+
+	// Dropped is called with the id of the oldest remaining record,
+	// whenever retention deleted segments. The log is locked during
+	// the call, so it must not be used.
+	Dropped func(firstId uint64)
+}
+
+var DefaultLogOptions = LogOptions{
+	SegmentSize: 4 << 20,
+	MaxSize:     64 << 20,
+	MaxAge:      0,
+}
+
+type segment struct {
+	firstId uint64
+	path    string
+	size    int64
+
+	// offsets holds the position of every record, followed by
+	// the end of the last one. Since ids are assigned in order,
+	// the record with id firstId+i starts at offsets[i].
+	offsets []int64
+}
+
+// count returns the number of records in the segment
+func (segment *segment) count() int {
+	return len(segment.offsets) - 1
+}
+
+// Log is a Store that appends records to segment files in a
+// directory. Every record is synced to disk before Append returns,
+// and records that were only partially written, e.g. due to a crash,
+// are discarded when the log is opened again. The position of every
+// record is kept in memory, so lookups only read what they need.
+type Log struct {
+	directory string
+	options   LogOptions
+	segments  []*segment
+	active    *os.File
+	nextId    uint64
+	mutex     sync.Mutex
+
+	// changes holds the latest edit or deletion & reactions holds the
+	// reactions of every changed message, so they can be applied
+	// without reading the whole log
+	changes   map[uint64]*Record
+	reactions map[uint64][]Reaction
+
+	// origins maps messages relayed from linked servers to their id
+	origins map[originKey]uint64
+
+	// done stops the goroutine enforcing the age limit
+	done chan struct{}
+}
+
+// originKey identifies a message by the server that assigned its id
+type originKey struct {
+	origin string
+	id     uint64
+}
+
+// OpenLog opens the log in the given directory, creating it if necessary
+func OpenLog(directory string, options LogOptions) (*Log, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	log := &Log{
+		directory: directory,
+		options:   options,
+		nextId:    1,
+		changes:   make(map[uint64]*Record),
+		reactions: make(map[uint64][]Reaction),
+		origins:   make(map[originKey]uint64),
+	}
+
+	if err := log.loadSegments(); err != nil {
+		return nil, err
+	}
+
+	if len(log.segments) == 0 {
+		if err := log.createSegment(); err != nil {
+			return nil, err
+		}
+	} else if err := log.restore(); err != nil {
+		return nil, err
+	}
+
+	if options.MaxAge > 0 {
+		log.done = make(chan struct{})
+		go log.watchAge(log.done)
+	}
+	return log, nil
+}
+
+// restore continues a log that already has segments
+func (log *Log) restore() error {
+	if err := log.recover(); err != nil {
+		return err
+	}
+	if err := log.enforceRetention(); err != nil {
+		return err
+	}
+	return log.loadIndex()
+}
+
+func (log *Log) Append(record *Record) error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if log.active == nil {
+		return os.ErrClosed
+	}
+
+	record.Id = log.nextId
+	frame := encodeFrame(encodeRecord(record))
+	current := log.segments[len(log.segments)-1]
+
+	if log.options.SegmentSize > 0 && current.size > 0 && current.size+int64(len(frame)) > log.options.SegmentSize {
+		if err := log.rotate(); err != nil {
+			return err
+		}
+		current = log.segments[len(log.segments)-1]
+	}
+
+	if _, err := log.active.Write(frame); err != nil {
+		// Remove what may have been written, so the next record isn't lost
+		log.rewind(current)
+		return err
+	}
+	if err := log.active.Sync(); err != nil {
+		// The record was not stored, so its id is used for the next one
+		log.rewind(current)
+		return err
+	}
+
+	current.size += int64(len(frame))
+	current.offsets = append(current.offsets, current.size)
+	log.nextId++
+
+	if record.Kind != KindMessage {
+		change := *record
+		log.trackChange(&change)
+	}
+	log.trackOrigin(record)
+	return nil
+}
+
+// rewind cuts off a record that was not written completely, and moves
+// the write position back to the end of the last complete record. If
+// that fails, the log is closed, since later records would be lost.
+func (log *Log) rewind(current *segment) {
+	err := log.active.Truncate(current.size)
+	if err == nil {
+		_, err = log.active.Seek(current.size, io.SeekStart)
+	}
+	if err != nil {
+		log.active.Close()
+		log.active = nil
+	}
+}
+
+func (log *Log) Last(n int) ([]*Record, error) {
+	return log.collect(n, math.MaxUint64, func(record *Record) bool { return true })
+}
+
+func (log *Log) Before(id uint64, n int) ([]*Record, error) {
+	return log.collect(n, id, func(record *Record) bool { return true })
+}
+
+func (log *Log) BeforeTime(timestamp time.Time, n int) ([]*Record, error) {
+	return log.collect(n, math.MaxUint64, func(record *Record) bool { return record.Timestamp.Before(timestamp) })
+}
+
+func (log *Log) After(id uint64, n int) ([]*Record, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	records := make([]*Record, 0, n)
+	err := log.scanForward(id+1, func(record *Record) bool {
+		if record.Kind == KindMessage {
+			records = append(records, record)
+		}
+		return len(records) < n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.applyChanges(records)
+	return records, nil
+}
+
+func (log *Log) Get(ids ...uint64) ([]*Record, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	records := make([]*Record, 0, len(ids))
+
+	for _, id := range ids {
+		segment, position, ok := log.locate(id)
+		if !ok {
+			continue
+		}
+
+		segmentRecords, err := readRecords(segment, position, position+1)
+		if err != nil {
+			return nil, err
+		}
+		if segmentRecords[0].Id == id && segmentRecords[0].Kind == KindMessage {
+			records = append(records, segmentRecords[0])
+		}
+	}
+	log.applyChanges(records)
+	return records, nil
+}
+
+func (log *Log) Replies(parent uint64, n int) ([]*Record, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	// Replies are always newer than their parent
+	records := make([]*Record, 0)
+	err := log.scanForward(parent+1, func(record *Record) bool {
+		if record.Kind == KindMessage && record.Parent == parent {
+			records = append(records, record)
+		}
+		return len(records) < n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.applyChanges(records)
+	return records, nil
+}
+
+func (log *Log) Find(origin string, originId uint64) (uint64, bool) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	id, ok := log.origins[originKey{origin, originId}]
+	return id, ok
+}
+
+func (log *Log) Scan(fn func(*Record) bool) error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	return log.scanForward(0, func(record *Record) bool {
+		if record.Kind != KindMessage {
+			return true
+		}
+		log.applyChanges([]*Record{record})
+		return fn(record)
+	})
+}
+
+// locate returns the segment containing the record
+// with the given id, and the position of the record
+func (log *Log) locate(id uint64) (*segment, int, bool) {
+	index, found := slices.BinarySearchFunc(log.segments, id, func(segment *segment, id uint64) int {
+		return cmp.Compare(segment.firstId, id)
+	})
+	if !found {
+		// The record belongs to the segment before
+		index--
+	}
+	if index < 0 {
+		return nil, 0, false
+	}
+
+	segment := log.segments[index]
+	position := id - segment.firstId
+	if position >= uint64(segment.count()) {
+		return nil, 0, false
+	}
+	return segment, int(position), true
+}
+
+// scanForward calls the function for every record starting
+// at the given id, oldest first, until it returns false
+func (log *Log) scanForward(from uint64, fn func(*Record) bool) error {
+	for _, segment := range log.segments {
+		start := 0
+		if from > segment.firstId {
+			start = int(min(from-segment.firstId, uint64(segment.count())))
+		}
+
+		for start < segment.count() {
+			end := min(start+readChunkSize, segment.count())
+			records, err := readRecords(segment, start, end)
+			if err != nil {
+				return err
+			}
+			for _, record := range records {
+				if !fn(record) {
+					return nil
+				}
+			}
+			start = end
+		}
+	}
+	return nil
+}
+
+// scanBackward calls the function for every record older
+// than the given id, newest first, until it returns false
+func (log *Log) scanBackward(before uint64, fn func(*Record) bool) error {
+	for i := len(log.segments) - 1; i >= 0; i-- {
+		segment := log.segments[i]
+		if segment.firstId >= before {
+			continue
+		}
+		end := int(min(before-segment.firstId, uint64(segment.count())))
+
+		for end > 0 {
+			start := max(end-readChunkSize, 0)
+			records, err := readRecords(segment, start, end)
+			if err != nil {
+				return err
+			}
+			for j := len(records) - 1; j >= 0; j-- {
+				if !fn(records[j]) {
+					return nil
+				}
+			}
+			end = start
+		}
+	}
+	return nil
+}
+
+// collect returns up to n of the newest messages
+// older than the given id, matching the filter
+func (log *Log) collect(n int, before uint64, filter func(*Record) bool) ([]*Record, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	records := make([]*Record, 0, n)
+	if n <= 0 {
+		return records, nil
+	}
+
+	err := log.scanBackward(before, func(record *Record) bool {
+		if record.Kind == KindMessage && filter(record) {
+			records = append(records, record)
+		}
+		return len(records) < n
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(records)
+	log.applyChanges(records)
+	return records, nil
+}
+
+// applyChanges updates messages with their latest
+// edit or deletion, and their current reactions
+func (log *Log) applyChanges(records []*Record) {
+	for _, record := range records {
+		if change, ok := log.changes[record.Id]; ok {
+			switch change.Kind {
+			case KindEdit:
+				record.Content = change.Content
+				record.Edited = true
+			case KindDelete:
+				record.Content = ""
+				record.Deleted = true
+			}
+		}
+
+		if record.Deleted {
+			continue
+		}
+
+		// Copy the reactions, since they change after the lock is released
+		for _, reaction := range log.reactions[record.Id] {
+			record.Reactions = append(record.Reactions, Reaction{
+				Emoji: reaction.Emoji,
+				Users: slices.Clone(reaction.Users),
+			})
+		}
+	}
+}
+
+// trackChange remembers the effect of a change record on its message
+func (log *Log) trackChange(change *Record) {
+	switch change.Kind {
+	case KindEdit, KindDelete:
+		log.changes[change.Target] = change
+	case KindReact:
+		log.reactions[change.Target] = addReaction(log.reactions[change.Target], change.Content, change.Sender)
+	case KindUnreact:
+		log.reactions[change.Target] = removeReaction(log.reactions[change.Target], change.Content, change.Sender)
+		if len(log.reactions[change.Target]) == 0 {
+			delete(log.reactions, change.Target)
+		}
+	}
+}
+
+// trackOrigin remembers the id of a message from a linked server
+func (log *Log) trackOrigin(record *Record) {
+	if record.Kind == KindMessage && record.Origin != "" && record.OriginId != 0 {
+		log.origins[originKey{record.Origin, record.OriginId}] = record.Id
+	}
+}
+
+func addReaction(reactions []Reaction, emoji string, user string) []Reaction {
+	for i := range reactions {
+		if reactions[i].Emoji != emoji {
+			continue
+		}
+		if !slices.Contains(reactions[i].Users, user) {
+			reactions[i].Users = append(reactions[i].Users, user)
+		}
+		return reactions
+	}
+	return append(reactions, Reaction{Emoji: emoji, Users: []string{user}})
+}
+
+func removeReaction(reactions []Reaction, emoji string, user string) []Reaction {
+	for i := range reactions {
+		if reactions[i].Emoji != emoji {
+			continue
+		}
+		reactions[i].Users = slices.DeleteFunc(reactions[i].Users, func(u string) bool { return u == user })
+		if len(reactions[i].Users) == 0 {
+			return slices.Delete(reactions, i, i+1)
+		}
+		return reactions
+	}
+	return reactions
+}
+
+// loadIndex reads every segment when opening the log, to find
+// the position of every record, all changes and all origins
+func (log *Log) loadIndex() error {
+	for _, segment := range log.segments {
+		segmentRecords, offsets, err := readSegment(segment.path)
+		if err != nil {
+			return err
+		}
+		segment.offsets = offsets
+
+		for _, record := range segmentRecords {
+			if record.Kind != KindMessage {
+				log.trackChange(record)
+			}
+			log.trackOrigin(record)
+		}
+	}
+	return nil
+}
+
+// Expire deletes the segments that are older than the age limit.
+// Unlike the size limit, it also applies to the active segment, which
+// is replaced once its newest record expired, so that records are
+// deleted even if the log never grows enough to start a new segment.
+func (log *Log) Expire() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if log.active == nil {
+		return os.ErrClosed
+	}
+
+	current := log.segments[len(log.segments)-1]
+	if current.count() > 0 && log.expired(current) {
+		return log.rotate()
+	}
+	return log.enforceRetention()
+}
+
+// watchAge calls Expire periodically, until the log is closed
+func (log *Log) watchAge(done <-chan struct{}) {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			// Failing to delete a segment is retried on the next tick
+			log.Expire()
+		}
+	}
+}
+
+func (log *Log) Close() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if log.done != nil {
+		close(log.done)
+		log.done = nil
+	}
+	if log.active == nil {
+		return nil
+	}
+	err := log.active.Close()
+	log.active = nil
+	return err
+}
+
+func (log *Log) loadSegments() error {
+	entries, err := os.ReadDir(log.directory)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExtension) {
+			continue
+		}
+
+		firstId, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExtension), 10, 64)
+		if err != nil {
+			// Not one of our files
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		log.segments = append(log.segments, &segment{
+			firstId: firstId,
+			path:    filepath.Join(log.directory, name),
+			size:    info.Size(),
+		})
+	}
+
+	slices.SortFunc(log.segments, func(a, b *segment) int {
+		return cmp.Compare(a.firstId, b.firstId)
+	})
+	return nil
+}
+
+// recover opens the newest segment for appending, after
+// cutting off a record that was not written completely
+func (log *Log) recover() error {
+	current := log.segments[len(log.segments)-1]
+
+	records, offsets, err := readSegment(current.path)
+	if err != nil {
+		return err
+	}
+	validSize := offsets[len(offsets)-1]
+
+	file, err := os.OpenFile(current.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	if validSize < current.size {
+		if err := file.Truncate(validSize); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to truncate damaged segment: %w", err)
+		}
+		current.size = validSize
+	}
+
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	log.active = file
+	log.nextId = current.firstId
+	if len(records) > 0 {
+		log.nextId = records[len(records)-1].Id + 1
+	}
+	return nil
+}
+
+func (log *Log) createSegment() error {
+	path := filepath.Join(log.directory, fmt.Sprintf("%020d%s", log.nextId, segmentExtension))
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	log.active = file
+	log.segments = append(log.segments, &segment{firstId: log.nextId, path: path, offsets: []int64{0}})
+	return nil
+}
+
+func (log *Log) rotate() error {
+	if err := log.active.Close(); err != nil {
+		return err
+	}
+	if err := log.createSegment(); err != nil {
+		log.active = nil
+		return err
+	}
+	return log.enforceRetention()
+}
+
+// enforceRetention deletes the oldest segments, until
+// the log is within the configured size & age limits
+func (log *Log) enforceRetention() error {
+	var totalSize int64
+	for _, segment := range log.segments {
+		totalSize += segment.size
+	}
+	firstId := log.segments[0].firstId
+	defer func() {
+		if log.options.Dropped != nil && log.segments[0].firstId != firstId {
+			log.options.Dropped(log.segments[0].firstId)
+		}
+	}()
+
+	for len(log.segments) > 1 {
+		oldest := log.segments[0]
+		expired := log.expired(oldest)
+
+		if log.options.MaxSize > 0 && totalSize > log.options.MaxSize {
+			expired = true
+		}
+		if !expired {
+			return nil
+		}
+
+		if err := os.Remove(oldest.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		totalSize -= oldest.size
+		log.segments = log.segments[1:]
+
+		// Changes to deleted messages are no longer needed
+		for target := range log.changes {
+			if target < log.segments[0].firstId {
+				delete(log.changes, target)
+			}
+		}
+		for target := range log.reactions {
+			if target < log.segments[0].firstId {
+				delete(log.reactions, target)
+			}
+		}
+		for key, id := range log.origins {
+			if id < log.segments[0].firstId {
+				delete(log.origins, key)
+			}
+		}
+	}
+	return nil
+}
+
+// expired reports whether all records of the segment are older than
+// the age limit. The last write to a segment is its newest record.
+func (log *Log) expired(segment *segment) bool {
+	if log.options.MaxAge <= 0 {
+		return false
+	}
+	info, err := os.Stat(segment.path)
+	return err == nil && time.Since(info.ModTime()) > log.options.MaxAge
+}
+
+func encodeFrame(payload []byte) []byte {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	return append(frame, payload...)
+}
+
+// readSegment reads all intact records of a segment, and returns
+// their offsets, followed by the end of the last intact record
+func readSegment(path string) ([]*Record, []int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	records := make([]*Record, 0)
+	offsets := []int64{0}
+	header := make([]byte, frameHeaderSize)
+	var offset int64
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			// Either the end of the segment, or a partial header
+			return records, offsets, nil
+		}
+
+		length := binary.LittleEndian.Uint32(header[0:4])
+		checksum := binary.LittleEndian.Uint32(header[4:8])
+
+		if offset+frameHeaderSize+int64(length) > info.Size() {
+			// A damaged length, or the record was cut off
+			return records, offsets, nil
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return records, offsets, nil
+		}
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return records, offsets, nil
+		}
+
+		record, err := decodeRecord(payload)
+		if err != nil {
+			return records, offsets, nil
+		}
+
+		records = append(records, record)
+		offset += frameHeaderSize + int64(length)
+		offsets = append(offsets, offset)
+	}
+}
+
+// readRecords reads the records between two positions of a
+// segment, which were found to be intact when they were indexed
+func readRecords(segment *segment, from int, to int) ([]*Record, error) {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, segment.offsets[to]-segment.offsets[from])
+	if _, err := file.ReadAt(data, segment.offsets[from]); err != nil {
+		return nil, err
+	}
+
+	records := make([]*Record, 0, to-from)
+	for len(data) > 0 {
+		if len(data) < frameHeaderSize {
+			return nil, errDamagedRecord
+		}
+		length := int(binary.LittleEndian.Uint32(data[0:4]))
+		if len(data) < frameHeaderSize+length {
+			return nil, errDamagedRecord
+		}
+
+		record, err := decodeRecord(data[frameHeaderSize : frameHeaderSize+length])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+		data = data[frameHeaderSize+length:]
+	}
+	return records, nil
+}
@@ -0,0 +1,532 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func appendMessages(t *testing.T, log *Log, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		record := &Record{Timestamp: time.Now(), Sender: "alice", Content: "hello"}
+		if err := log.Append(record); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	directory := t.TempDir()
+
+	log, err := OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 5)
+	log.Close()
+
+	// Records must survive reopening the log
+	log, err = OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+	appendMessages(t, log, 1)
+
+	records, err := log.Last(3)
+	if err != nil {
+		t.Fatalf("Last failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Last returned %d records, want 3", len(records))
+	}
+	for i, record := range records {
+		if record.Id != uint64(4+i) {
+			t.Errorf("Record %d has id %d, want %d", i, record.Id, 4+i)
+		}
+		if record.Sender != "alice" || record.Content != "hello" {
+			t.Errorf("Record %d does not match: %+v", i, record)
+		}
+	}
+}
+
+func TestLogRecovery(t *testing.T) {
+	directory := t.TempDir()
+
+	log, err := OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 2)
+	path := log.segments[0].path
+	log.Close()
+
+	// Simulate a crash in the middle of writing a record
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open segment: %v", err)
+	}
+	file.Write([]byte{0xff, 0x00, 0x00, 0x00, 0x01})
+	file.Close()
+
+	log, err = OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+	appendMessages(t, log, 1)
+
+	records, err := log.Last(10)
+	if err != nil {
+		t.Fatalf("Last failed: %v", err)
+	}
+	if len(records) != 3 || records[2].Id != 3 {
+		t.Fatalf("Expected 3 records after recovery, got %d", len(records))
+	}
+}
+
+func TestLogRewind(t *testing.T) {
+	directory := t.TempDir()
+
+	log, err := OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 2)
+
+	// Simulate a write that failed halfway through a record
+	log.active.Write([]byte{0xff, 0x00, 0x00, 0x00, 0x01})
+	log.rewind(log.segments[0])
+	appendMessages(t, log, 1)
+	log.Close()
+
+	log, err = OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+
+	records, err := log.Last(10)
+	if err != nil {
+		t.Fatalf("Last failed: %v", err)
+	}
+	if len(records) != 3 || records[2].Id != 3 {
+		t.Fatalf("Expected 3 records after a failed write, got %d", len(records))
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	directory := t.TempDir()
+	frameSize := int64(len(encodeFrame(encodeRecord(&Record{Sender: "alice", Content: "hello"}))))
+
+	// Two records per segment, and at most four records in total
+	var firstId uint64
+	options := LogOptions{
+		SegmentSize: 2 * frameSize,
+		MaxSize:     4 * frameSize,
+		Dropped:     func(id uint64) { firstId = id },
+	}
+
+	log, err := OpenLog(directory, options)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+	appendMessages(t, log, 7)
+
+	segments, _ := filepath.Glob(filepath.Join(directory, "*"+segmentExtension))
+	if len(segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %d", len(segments))
+	}
+
+	records, err := log.Last(10)
+	if err != nil {
+		t.Fatalf("Last failed: %v", err)
+	}
+	if len(records) != 5 || records[0].Id != 3 {
+		t.Fatalf("Expected records 3 to 7, got %d records", len(records))
+	}
+	if firstId != 3 {
+		t.Fatalf("Dropped reported record %d as the oldest, want 3", firstId)
+	}
+}
+
+func TestLogExpire(t *testing.T) {
+	directory := t.TempDir()
+
+	var firstId uint64
+	options := LogOptions{
+		MaxAge:  time.Hour,
+		Dropped: func(id uint64) { firstId = id },
+	}
+
+	log, err := OpenLog(directory, options)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+	appendMessages(t, log, 3)
+
+	// Recent records are kept, even in the active segment
+	if err := log.Expire(); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	if records, _ := log.Last(10); len(records) != 3 {
+		t.Fatalf("Expected 3 records before they expired, got %d", len(records))
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(log.segments[0].path, old, old); err != nil {
+		t.Fatalf("Failed to change segment time: %v", err)
+	}
+	if err := log.Expire(); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+
+	if records, _ := log.Last(10); len(records) != 0 {
+		t.Fatalf("Expected no records after they expired, got %d", len(records))
+	}
+	if firstId != 4 {
+		t.Fatalf("Dropped reported record %d as the oldest, want 4", firstId)
+	}
+
+	appendMessages(t, log, 1)
+	if records, _ := log.Last(10); len(records) != 1 || records[0].Id != 4 {
+		t.Fatal("Expected a new record with id 4 after expiring")
+	}
+}
+
+func TestLogBefore(t *testing.T) {
+	frameSize := int64(len(encodeFrame(encodeRecord(&Record{Sender: "alice", Content: "hello"}))))
+
+	log, err := OpenLog(t.TempDir(), LogOptions{SegmentSize: 3 * frameSize})
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		record := &Record{Timestamp: start.Add(time.Duration(i) * time.Second), Sender: "alice", Content: "hello"}
+		if err := log.Append(record); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	// The page spans multiple segments
+	records, err := log.Before(8, 4)
+	if err != nil {
+		t.Fatalf("Before failed: %v", err)
+	}
+	if len(records) != 4 || records[0].Id != 4 || records[3].Id != 7 {
+		t.Fatalf("Expected records 4 to 7, got %d records", len(records))
+	}
+
+	records, err = log.BeforeTime(start.Add(2*time.Second), 10)
+	if err != nil {
+		t.Fatalf("BeforeTime failed: %v", err)
+	}
+	if len(records) != 2 || records[1].Id != 2 {
+		t.Fatalf("Expected records 1 to 2, got %d records", len(records))
+	}
+
+	records, err = log.After(5, 3)
+	if err != nil {
+		t.Fatalf("After failed: %v", err)
+	}
+	if len(records) != 3 || records[0].Id != 6 || records[2].Id != 8 {
+		t.Fatalf("Expected records 6 to 8, got %d records", len(records))
+	}
+
+	records, err = log.Get(9, 2, 42)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Id != 2 || records[1].Id != 9 {
+		t.Fatalf("Expected records 2 and 9, got %d records", len(records))
+	}
+
+	records, err = log.Before(1, 10)
+	if err != nil {
+		t.Fatalf("Before failed: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("Expected no records before the first one, got %d", len(records))
+	}
+}
+
+func TestLogChanges(t *testing.T) {
+	directory := t.TempDir()
+
+	log, err := OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 3)
+
+	changes := []*Record{
+		{Kind: KindEdit, Target: 1, Content: "typo"},
+		{Kind: KindEdit, Target: 1, Content: "fixed"},
+		{Kind: KindDelete, Target: 2},
+	}
+	for _, change := range changes {
+		if err := log.Append(change); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	log.Close()
+
+	// Changes must be applied after reopening the log as well
+	log, err = OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+
+	records, err := log.Last(10)
+	if err != nil {
+		t.Fatalf("Last failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Last returned %d records, want only the 3 messages", len(records))
+	}
+	if records[0].Content != "fixed" || !records[0].Edited {
+		t.Errorf("Expected the latest edit to be applied, got %+v", records[0])
+	}
+	if records[1].Content != "" || !records[1].Deleted {
+		t.Errorf("Expected the deletion to be applied, got %+v", records[1])
+	}
+	if records[2].Edited || records[2].Deleted {
+		t.Errorf("Expected the last message to be unchanged, got %+v", records[2])
+	}
+
+	records, err = log.Get(1, 4)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Content != "fixed" {
+		t.Fatalf("Expected only the edited message, got %d records", len(records))
+	}
+}
+
+func TestLogReactions(t *testing.T) {
+	directory := t.TempDir()
+
+	log, err := OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 1)
+
+	changes := []*Record{
+		{Kind: KindReact, Target: 1, Sender: "alice", Content: "👍"},
+		{Kind: KindReact, Target: 1, Sender: "bob", Content: "👍"},
+		{Kind: KindReact, Target: 1, Sender: "bob", Content: "🎉"},
+		{Kind: KindUnreact, Target: 1, Sender: "bob", Content: "🎉"},
+		{Kind: KindReact, Target: 1, Sender: "carol", Content: "😂"},
+	}
+	for _, change := range changes {
+		if err := log.Append(change); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	log.Close()
+
+	log, err = OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+
+	records, err := log.Get(1)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Get returned %d records, want 1", len(records))
+	}
+
+	reactions := records[0].Reactions
+	if len(reactions) != 2 {
+		t.Fatalf("Expected 2 reactions, got %+v", reactions)
+	}
+	if reactions[0].Emoji != "👍" || len(reactions[0].Users) != 2 {
+		t.Errorf("Expected 2 users to react with 👍, got %+v", reactions[0])
+	}
+	if reactions[1].Emoji != "😂" || reactions[1].Users[0] != "carol" {
+		t.Errorf("Expected carol to react with 😂, got %+v", reactions[1])
+	}
+}
+
+func TestLogReplies(t *testing.T) {
+	frameSize := int64(len(encodeFrame(encodeRecord(&Record{Sender: "alice", Content: "hello"}))))
+
+	log, err := OpenLog(t.TempDir(), LogOptions{SegmentSize: 3 * frameSize})
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+
+	appendMessages(t, log, 2)
+	for i := 0; i < 6; i++ {
+		// Replies alternate between both messages
+		record := &Record{Timestamp: time.Now(), Sender: "bob", Content: "reply", Parent: uint64(1 + i%2)}
+		if err := log.Append(record); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	records, err := log.Replies(2, 10)
+	if err != nil {
+		t.Fatalf("Replies failed: %v", err)
+	}
+	if len(records) != 3 || records[0].Id != 4 || records[2].Id != 8 {
+		t.Fatalf("Expected replies 4, 6 and 8, got %d records", len(records))
+	}
+
+	records, err = log.Replies(1, 2)
+	if err != nil {
+		t.Fatalf("Replies failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Id != 3 || records[1].Parent != 1 {
+		t.Fatalf("Expected the first 2 replies to message 1, got %d records", len(records))
+	}
+}
+
+func TestRecordVersions(t *testing.T) {
+	record := &Record{
+		Id:        7,
+		Timestamp: time.Now(),
+		Sender:    "alice",
+		Content:   "waves",
+		Parent:    3,
+		Action:    true,
+		Origin:    "hub",
+		OriginId:  9,
+	}
+	data := encodeRecord(record)
+
+	decoded, err := decodeRecord(data)
+	if err != nil {
+		t.Fatalf("decodeRecord failed: %v", err)
+	}
+	if !decoded.Action || decoded.Parent != 3 || decoded.Content != "waves" || decoded.Origin != "hub" || decoded.OriginId != 9 {
+		t.Fatalf("Decoded record does not match: %+v", decoded)
+	}
+
+	// Version 4 records end after the content
+	data = append([]byte{4}, data[1:len(data)-15]...)
+
+	decoded, err = decodeRecord(data)
+	if err != nil {
+		t.Fatalf("decodeRecord failed for version 4: %v", err)
+	}
+	if !decoded.Action || decoded.Content != "waves" || decoded.Origin != "" || decoded.OriginId != 0 {
+		t.Fatalf("Decoded version 4 record does not match: %+v", decoded)
+	}
+
+	// Version 3 records have no action flag, which follows the parent
+	previous := append([]byte{3}, data[1:34]...)
+	previous = append(previous, data[35:]...)
+
+	decoded, err = decodeRecord(previous)
+	if err != nil {
+		t.Fatalf("decodeRecord failed for version 3: %v", err)
+	}
+	if decoded.Action || decoded.Parent != 3 || decoded.Sender != "alice" {
+		t.Fatalf("Decoded version 3 record does not match: %+v", decoded)
+	}
+}
+
+func TestLogIndex(t *testing.T) {
+	directory := t.TempDir()
+	frameSize := int64(len(encodeFrame(encodeRecord(&Record{Sender: "alice", Content: "hello"}))))
+	options := LogOptions{SegmentSize: 3 * frameSize}
+
+	log, err := OpenLog(directory, options)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 7)
+	log.Close()
+
+	// The index is rebuilt from the segments, and extended by appends
+	log, err = OpenLog(directory, options)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+	appendMessages(t, log, 2)
+
+	tests := []struct {
+		id    uint64
+		found bool
+	}{
+		{0, false},
+		{1, true},
+		{3, true},
+		{4, true},
+		{7, true},
+		{8, true},
+		{9, true},
+		{10, false},
+	}
+
+	for _, test := range tests {
+		records, err := log.Get(test.id)
+		if err != nil {
+			t.Fatalf("Get of record %d failed: %v", test.id, err)
+		}
+		if (len(records) > 0) != test.found {
+			t.Fatalf("Get of record %d returned %d records, expected found=%v", test.id, len(records), test.found)
+		}
+		if test.found && (records[0].Id != test.id || records[0].Content != "hello") {
+			t.Fatalf("Get of record %d returned %+v", test.id, records[0])
+		}
+	}
+}
+
+func TestLogOrigins(t *testing.T) {
+	directory := t.TempDir()
+
+	log, err := OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	appendMessages(t, log, 2)
+
+	remote := &Record{Timestamp: time.Now(), Sender: "bob@hub", Content: "hi", Origin: "hub", OriginId: 40}
+	if err := log.Append(remote); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	log.Close()
+
+	// Origins are found again after reopening the log
+	log, err = OpenLog(directory, DefaultLogOptions)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer log.Close()
+
+	tests := []struct {
+		origin   string
+		originId uint64
+		id       uint64
+		found    bool
+	}{
+		{"hub", 40, 3, true},
+		{"hub", 41, 0, false},
+		{"other", 40, 0, false},
+		{"", 1, 0, false},
+	}
+
+	for _, test := range tests {
+		id, found := log.Find(test.origin, test.originId)
+		if found != test.found || id != test.id {
+			t.Fatalf("Find of %d@%s failed: got %d, %v", test.originId, test.origin, id, found)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package irc
+
+// Numeric replies from RFC 1459 & RFC 2812
+const (
+	RplWelcome          = "001"
+	RplYourHost         = "002"
+	RplCreated          = "003"
+	RplMyInfo           = "004"
+	RplNoTopic          = "331"
+	RplNamReply         = "353"
+	RplEndOfNames       = "366"
+	ErrNoSuchNick       = "401"
+	ErrNoSuchChannel    = "403"
+	ErrNoRecipient      = "411"
+	ErrNoTextToSend     = "412"
+	ErrUnknownCommand   = "421"
+	ErrNoMotd           = "422"
+	ErrNoNicknameGiven  = "431"
+	ErrErroneusNickname = "432"
+	ErrNicknameInUse    = "433"
+	ErrNotRegistered    = "451"
+	ErrNeedMoreParams   = "461"
+	ErrAlreadyRegistred = "462"
+)
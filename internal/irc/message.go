@@ -0,0 +1,102 @@
+package irc
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxLineLength is the maximum length of a line including
+// the trailing CRLF, as defined in RFC 1459
+const MaxLineLength = 512
+
+var ErrEmptyMessage = errors.New("irc: empty message")
+
+// Message is a single IRC protocol line
+type Message struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Param returns the parameter at the given index, or an
+// empty string if the message has fewer parameters
+func (m *Message) Param(index int) string {
+	if index < 0 || index >= len(m.Params) {
+		return ""
+	}
+	return m.Params[index]
+}
+
+// Parse reads a message from a single line, without the trailing CRLF
+func Parse(line string) (*Message, error) {
+	line = strings.TrimRight(line, "\r\n")
+	message := &Message{}
+
+	if strings.HasPrefix(line, "@") {
+		// We don't support message tags (IRCv3), so skip them
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		message.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	line = strings.TrimLeft(line, " ")
+	if line == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			// The trailing parameter may contain spaces
+			message.Params = append(message.Params, line[1:])
+			break
+		}
+
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		line = strings.TrimLeft(line, " ")
+
+		if message.Command == "" {
+			message.Command = strings.ToUpper(param)
+			continue
+		}
+		message.Params = append(message.Params, param)
+	}
+
+	if message.Command == "" {
+		return nil, ErrEmptyMessage
+	}
+	return message, nil
+}
+
+// String formats the message as a line, without the trailing CRLF
+func (m *Message) String() string {
+	var builder strings.Builder
+
+	if m.Prefix != "" {
+		builder.WriteString(":" + m.Prefix + " ")
+	}
+	builder.WriteString(m.Command)
+
+	for i, param := range m.Params {
+		builder.WriteString(" ")
+		isLast := i == len(m.Params)-1
+
+		if isLast && (param == "" || strings.Contains(param, " ") || strings.HasPrefix(param, ":")) {
+			builder.WriteString(":")
+		}
+		builder.WriteString(param)
+	}
+
+	return builder.String()
+}
+
+// NewMessage creates a message from a prefix, command and parameters
+func NewMessage(prefix string, command string, params ...string) *Message {
+	return &Message{
+		Prefix:  prefix,
+		Command: command,
+		Params:  params,
+	}
+}
@@ -0,0 +1,56 @@
+package irc
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected Message
+	}{
+		{"PING :abc", Message{"", "PING", []string{"abc"}}},
+		{"nick alice", Message{"", "NICK", []string{"alice"}}},
+		{"USER alice 0 * :Alice Liddell\r\n", Message{"", "USER", []string{"alice", "0", "*", "Alice Liddell"}}},
+		{":alice!a@host PRIVMSG #chat :hello :)", Message{"alice!a@host", "PRIVMSG", []string{"#chat", "hello :)"}}},
+		{"@time=now :srv NOTICE  bob  :hi", Message{"srv", "NOTICE", []string{"bob", "hi"}}},
+	}
+
+	for _, test := range tests {
+		message, err := Parse(test.line)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.line, err)
+			continue
+		}
+		if message.Prefix != test.expected.Prefix ||
+			message.Command != test.expected.Command ||
+			!slices.Equal(message.Params, test.expected.Params) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.line, *message, test.expected)
+		}
+	}
+
+	for _, line := range []string{"", "   ", ":prefix-only"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) should have failed", line)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		message  *Message
+		expected string
+	}{
+		{NewMessage("", "PONG", "srv"), "PONG srv"},
+		{NewMessage("srv", "001", "alice", "Welcome home"), ":srv 001 alice :Welcome home"},
+		{NewMessage("a!a@h", "PRIVMSG", "#chat", ":)"), ":a!a@h PRIVMSG #chat ::)"},
+		{NewMessage("", "QUIT", ""), "QUIT :"},
+	}
+
+	for _, test := range tests {
+		if line := test.message.String(); line != test.expected {
+			t.Errorf("String() = %q, want %q", line, test.expected)
+		}
+	}
+}
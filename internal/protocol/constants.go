@@ -2,6 +2,8 @@ package protocol
 
 type PacketId uint16
 type EncryptionType uint8
+type PresenceState uint8
+type MessageKind uint8
 
 const (
 	PacketIdError PacketId = iota
@@ -12,9 +14,50 @@ const (
 	PacketIdJoin
 	PacketIdQuit
 	PacketIdMessage
+	PacketIdServerShutdown
+	PacketIdLinkHello
+	PacketIdLinkEvent
+	PacketIdHistory
+	PacketIdHistoryRequest
+	PacketIdSearch
+	PacketIdSearchResults
+	PacketIdSearchContext
+	PacketIdMessageAck
+	PacketIdEditMessage
+	PacketIdDeleteMessage
+	PacketIdReact
+	PacketIdReactions
+	PacketIdThreadRequest
+	PacketIdThread
+	PacketIdTyping
+	PacketIdPresence
+	PacketIdWhois
+	PacketIdWhoisReply
+	PacketIdLinkNonce
 )
 
 const (
 	EncryptionTypeNone EncryptionType = iota
 	EncryptionTypeAES
 )
+
+const (
+	MessageKindNormal MessageKind = iota
+	MessageKindAction
+	MessageKindNotice
+	MessageKindSystem
+)
+
+const (
+	PresenceOnline PresenceState = iota
+	PresenceAway
+	PresenceDoNotDisturb
+)
+
+// Error codes that clients handle differently from other errors
+const (
+	ErrorCodeRateLimited uint16 = 11
+	ErrorCodeMuted       uint16 = 12
+	ErrorCodeFlooding    uint16 = 13
+	ErrorCodeQueryLimit  uint16 = 25
+)
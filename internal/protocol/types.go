@@ -39,6 +39,22 @@ type Message struct {
 	Serializable
 	Sender  string
 	Content string
+
+	// Nonce is chosen by the sending client, which receives
+	// it back in a MessageAck. It is zero in broadcasts.
+	Nonce uint64
+
+	// Id is assigned by the server when storing the message,
+	// and is zero if the server doesn't keep a history
+	Id uint64
+
+	// ParentId is the id of the message this replies to, or zero.
+	// The server always sets it to the message starting the thread.
+	ParentId uint64
+
+	// Kind is set to an action for messages sent with "/me". Notices
+	// & system messages can only be sent by the server.
+	Kind MessageKind
 }
 
 func (m *Message) ToBytes() ([]byte, error) {
@@ -56,6 +72,18 @@ func (m *Message) Serialize(w io.Writer) error {
 	if err := writeString(w, m.Content); err != nil {
 		return err
 	}
+	if err := writeUint64(w, m.Nonce); err != nil {
+		return err
+	}
+	if err := writeUint64(w, m.Id); err != nil {
+		return err
+	}
+	if err := writeUint64(w, m.ParentId); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(m.Kind)); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -68,6 +96,23 @@ func (m *Message) Deserialize(r io.Reader) (err error) {
 	if err != nil {
 		return err
 	}
+	m.Nonce, err = readUint64(r)
+	if err != nil {
+		return optional(err)
+	}
+	m.Id, err = readUint64(r)
+	if err != nil {
+		return optional(err)
+	}
+	m.ParentId, err = readUint64(r)
+	if err != nil {
+		return optional(err)
+	}
+	kind, err := readUint8(r)
+	if err != nil {
+		return optional(err)
+	}
+	m.Kind = MessageKind(kind)
 	return nil
 }
 
@@ -136,6 +181,37 @@ func (ul *UserList) Deserialize(r io.Reader) (err error) {
 	return nil
 }
 
+// Nickname is sent by clients to authenticate, along with
+// the name & version of the client they are using
+type Nickname struct {
+	Serializable
+	Name   string
+	Client string
+}
+
+func (n *Nickname) ToBytes() ([]byte, error) {
+	return toBytes(n)
+}
+
+func (n *Nickname) FromBytes(data []byte) error {
+	return fromBytes(data, n)
+}
+
+func (n *Nickname) Serialize(w io.Writer) error {
+	if err := writeString(w, n.Name); err != nil {
+		return err
+	}
+	return writeString(w, n.Client)
+}
+
+func (n *Nickname) Deserialize(r io.Reader) (err error) {
+	if n.Name, err = readString(r); err != nil {
+		return err
+	}
+	n.Client, err = readString(r)
+	return optional(err)
+}
+
 type Challenge struct {
 	Serializable
 	Data []byte
@@ -205,3 +281,775 @@ func (e *Error) Deserialize(r io.Reader) (err error) {
 	}
 	return nil
 }
+
+// LinkEvent wraps a packet that is relayed between linked servers
+type LinkEvent struct {
+	Serializable
+	Id       uint64
+	Origin   string
+	PacketId PacketId
+	Data     []byte
+}
+
+func (e *LinkEvent) ToBytes() ([]byte, error) {
+	return toBytes(e)
+}
+
+func (e *LinkEvent) FromBytes(data []byte) error {
+	return fromBytes(data, e)
+}
+
+func (e *LinkEvent) Serialize(w io.Writer) error {
+	if err := writeUint64(w, e.Id); err != nil {
+		return err
+	}
+	if err := writeString(w, e.Origin); err != nil {
+		return err
+	}
+	if err := writeUint16(w, uint16(e.PacketId)); err != nil {
+		return err
+	}
+	if err := writeUint32(w, uint32(len(e.Data))); err != nil {
+		return err
+	}
+	if _, err := w.Write(e.Data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *LinkEvent) Deserialize(r io.Reader) (err error) {
+	if e.Id, err = readUint64(r); err != nil {
+		return err
+	}
+	if e.Origin, err = readString(r); err != nil {
+		return err
+	}
+
+	packetId, err := readUint16(r)
+	if err != nil {
+		return err
+	}
+	e.PacketId = PacketId(packetId)
+
+	length, err := readUint32(r)
+	if err != nil {
+		return err
+	}
+
+	// Don't trust the length before the data was actually read
+	if e.Data, err = io.ReadAll(io.LimitReader(r, int64(length))); err != nil {
+		return err
+	}
+	if len(e.Data) != int(length) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// LinkHello introduces a server to the server it is linking with,
+// proving that it knows the link secret of both servers
+type LinkHello struct {
+	Serializable
+	Name  string
+	Proof []byte
+}
+
+func (h *LinkHello) ToBytes() ([]byte, error) {
+	return toBytes(h)
+}
+
+func (h *LinkHello) FromBytes(data []byte) error {
+	return fromBytes(data, h)
+}
+
+func (h *LinkHello) Serialize(w io.Writer) error {
+	if err := writeString(w, h.Name); err != nil {
+		return err
+	}
+	if err := writeUint16(w, uint16(len(h.Proof))); err != nil {
+		return err
+	}
+	if _, err := w.Write(h.Proof); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (h *LinkHello) Deserialize(r io.Reader) (err error) {
+	if h.Name, err = readString(r); err != nil {
+		return err
+	}
+
+	length, err := readUint16(r)
+	if err != nil {
+		return err
+	}
+
+	h.Proof = make([]byte, length)
+	if _, err := io.ReadFull(r, h.Proof); err != nil {
+		return err
+	}
+	return nil
+}
+
+// HistoryMessage is a message that was sent before the client connected
+type HistoryMessage struct {
+	Serializable
+	Id        uint64
+	Timestamp int64 // Unix time in milliseconds
+	Sender    string
+	Content   string
+	Edited    bool
+	Deleted   bool
+	Reactions []Reaction
+	ParentId  uint64
+	Kind      MessageKind
+}
+
+func (m *HistoryMessage) ToBytes() ([]byte, error) {
+	return toBytes(m)
+}
+
+func (m *HistoryMessage) FromBytes(data []byte) error {
+	return fromBytes(data, m)
+}
+
+func (m *HistoryMessage) Serialize(w io.Writer) error {
+	if err := writeUint64(w, m.Id); err != nil {
+		return err
+	}
+	if err := writeInt64(w, m.Timestamp); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Sender); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Content); err != nil {
+		return err
+	}
+	if err := writeBoolean(w, m.Edited); err != nil {
+		return err
+	}
+	if err := writeBoolean(w, m.Deleted); err != nil {
+		return err
+	}
+	if err := writeReactions(w, m.Reactions); err != nil {
+		return err
+	}
+	if err := writeUint64(w, m.ParentId); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(m.Kind)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *HistoryMessage) Deserialize(r io.Reader) (err error) {
+	if m.Id, err = readUint64(r); err != nil {
+		return err
+	}
+	if m.Timestamp, err = readInt64(r); err != nil {
+		return err
+	}
+	if m.Sender, err = readString(r); err != nil {
+		return err
+	}
+	if m.Content, err = readString(r); err != nil {
+		return err
+	}
+	if m.Edited, err = readBoolean(r); err != nil {
+		return optional(err)
+	}
+	if m.Deleted, err = readBoolean(r); err != nil {
+		return optional(err)
+	}
+	if m.Reactions, err = readReactions(r); err != nil {
+		return optional(err)
+	}
+	if m.ParentId, err = readUint64(r); err != nil {
+		return optional(err)
+	}
+	kind, err := readUint8(r)
+	if err != nil {
+		return optional(err)
+	}
+	m.Kind = MessageKind(kind)
+	return nil
+}
+
+// HistoryBatch contains stored messages, oldest first
+type HistoryBatch struct {
+	Serializable
+	Messages []HistoryMessage
+}
+
+func (b *HistoryBatch) ToBytes() ([]byte, error) {
+	return toBytes(b)
+}
+
+func (b *HistoryBatch) FromBytes(data []byte) error {
+	return fromBytes(data, b)
+}
+
+func (b *HistoryBatch) Serialize(w io.Writer) error {
+	if err := writeUint32(w, uint32(len(b.Messages))); err != nil {
+		return err
+	}
+	for _, message := range b.Messages {
+		// Every message is prefixed with its length, so that
+		// fields can be added to it without breaking older peers
+		data, err := message.ToBytes()
+		if err != nil {
+			return err
+		}
+		if err := writeUint32(w, uint32(len(data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *HistoryBatch) Deserialize(r io.Reader) (err error) {
+	var length uint32
+	length, err = readUint32(r)
+	if err != nil {
+		return err
+	}
+
+	// Don't trust the length for the allocation
+	b.Messages = make([]HistoryMessage, 0, min(length, 256))
+	for i := uint32(0); i < length; i++ {
+		size, err := readUint32(r)
+		if err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r, int64(size)))
+		if err != nil {
+			return err
+		}
+		if len(data) != int(size) {
+			return io.ErrUnexpectedEOF
+		}
+
+		// Fields from newer peers after the ones we know are ignored
+		var message HistoryMessage
+		if err = message.FromBytes(data); err != nil {
+			return err
+		}
+		b.Messages = append(b.Messages, message)
+	}
+	return nil
+}
+
+// HistoryRequest asks for messages older than the given message id,
+// or older than the given timestamp if the id is zero
+type HistoryRequest struct {
+	Serializable
+	BeforeId        uint64
+	BeforeTimestamp int64 // Unix time in milliseconds
+	Limit           uint16
+}
+
+func (r *HistoryRequest) ToBytes() ([]byte, error) {
+	return toBytes(r)
+}
+
+func (r *HistoryRequest) FromBytes(data []byte) error {
+	return fromBytes(data, r)
+}
+
+func (r *HistoryRequest) Serialize(w io.Writer) error {
+	if err := writeUint64(w, r.BeforeId); err != nil {
+		return err
+	}
+	if err := writeInt64(w, r.BeforeTimestamp); err != nil {
+		return err
+	}
+	if err := writeUint16(w, r.Limit); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *HistoryRequest) Deserialize(rd io.Reader) (err error) {
+	if r.BeforeId, err = readUint64(rd); err != nil {
+		return err
+	}
+	if r.BeforeTimestamp, err = readInt64(rd); err != nil {
+		return err
+	}
+	if r.Limit, err = readUint16(rd); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SearchQuery asks for stored messages containing all words of the
+// text. Empty senders and zero timestamps don't restrict the results.
+type SearchQuery struct {
+	Serializable
+	Text   string
+	Sender string
+	After  int64 // Unix time in milliseconds
+	Before int64 // Unix time in milliseconds
+	Limit  uint16
+}
+
+func (q *SearchQuery) ToBytes() ([]byte, error) {
+	return toBytes(q)
+}
+
+func (q *SearchQuery) FromBytes(data []byte) error {
+	return fromBytes(data, q)
+}
+
+func (q *SearchQuery) Serialize(w io.Writer) error {
+	if err := writeString(w, q.Text); err != nil {
+		return err
+	}
+	if err := writeString(w, q.Sender); err != nil {
+		return err
+	}
+	if err := writeInt64(w, q.After); err != nil {
+		return err
+	}
+	if err := writeInt64(w, q.Before); err != nil {
+		return err
+	}
+	if err := writeUint16(w, q.Limit); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (q *SearchQuery) Deserialize(r io.Reader) (err error) {
+	if q.Text, err = readString(r); err != nil {
+		return err
+	}
+	if q.Sender, err = readString(r); err != nil {
+		return err
+	}
+	if q.After, err = readInt64(r); err != nil {
+		return err
+	}
+	if q.Before, err = readInt64(r); err != nil {
+		return err
+	}
+	if q.Limit, err = readUint16(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MessageId refers to a single stored message
+type MessageId struct {
+	Serializable
+	Id uint64
+}
+
+func (m *MessageId) ToBytes() ([]byte, error) {
+	return toBytes(m)
+}
+
+func (m *MessageId) FromBytes(data []byte) error {
+	return fromBytes(data, m)
+}
+
+func (m *MessageId) Serialize(w io.Writer) error {
+	return writeUint64(w, m.Id)
+}
+
+func (m *MessageId) Deserialize(r io.Reader) (err error) {
+	m.Id, err = readUint64(r)
+	return err
+}
+
+// MessageAck tells a client whether the server accepted its message.
+// A zero code means it was delivered, otherwise it is the code of the
+// error that was sent along with it.
+type MessageAck struct {
+	Serializable
+	Nonce     uint64
+	Id        uint64 // Zero if the history is disabled
+	Timestamp int64  // Unix time in milliseconds
+	Code      uint16
+}
+
+func (a *MessageAck) ToBytes() ([]byte, error) {
+	return toBytes(a)
+}
+
+func (a *MessageAck) FromBytes(data []byte) error {
+	return fromBytes(data, a)
+}
+
+func (a *MessageAck) Serialize(w io.Writer) error {
+	if err := writeUint64(w, a.Nonce); err != nil {
+		return err
+	}
+	if err := writeUint64(w, a.Id); err != nil {
+		return err
+	}
+	if err := writeInt64(w, a.Timestamp); err != nil {
+		return err
+	}
+	if err := writeUint16(w, a.Code); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *MessageAck) Deserialize(r io.Reader) (err error) {
+	if a.Nonce, err = readUint64(r); err != nil {
+		return err
+	}
+	if a.Id, err = readUint64(r); err != nil {
+		return err
+	}
+	if a.Timestamp, err = readInt64(r); err != nil {
+		return err
+	}
+	if a.Code, err = readUint16(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MessageEdit replaces the content of a stored message. Clients send
+// it to edit their own messages, and the server broadcasts it once the
+// edit was stored.
+type MessageEdit struct {
+	Serializable
+	Id      uint64
+	Content string
+}
+
+func (e *MessageEdit) ToBytes() ([]byte, error) {
+	return toBytes(e)
+}
+
+func (e *MessageEdit) FromBytes(data []byte) error {
+	return fromBytes(data, e)
+}
+
+func (e *MessageEdit) Serialize(w io.Writer) error {
+	if err := writeUint64(w, e.Id); err != nil {
+		return err
+	}
+	if err := writeString(w, e.Content); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *MessageEdit) Deserialize(r io.Reader) (err error) {
+	if e.Id, err = readUint64(r); err != nil {
+		return err
+	}
+	if e.Content, err = readString(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reaction is an emoji, along with the users who reacted with it
+type Reaction struct {
+	Serializable
+	Emoji string
+	Users []string
+}
+
+func (re *Reaction) ToBytes() ([]byte, error) {
+	return toBytes(re)
+}
+
+func (re *Reaction) FromBytes(data []byte) error {
+	return fromBytes(data, re)
+}
+
+func (re *Reaction) Serialize(w io.Writer) error {
+	if err := writeString(w, re.Emoji); err != nil {
+		return err
+	}
+	return writeStrings(w, re.Users)
+}
+
+func (re *Reaction) Deserialize(r io.Reader) (err error) {
+	if re.Emoji, err = readString(r); err != nil {
+		return err
+	}
+	re.Users, err = readStrings(r)
+	return err
+}
+
+func writeReactions(w io.Writer, reactions []Reaction) error {
+	if err := writeUint32(w, uint32(len(reactions))); err != nil {
+		return err
+	}
+	for _, reaction := range reactions {
+		if err := reaction.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readReactions(r io.Reader) ([]Reaction, error) {
+	length, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := make([]Reaction, 0, min(length, 256))
+	for i := uint32(0); i < length; i++ {
+		var reaction Reaction
+		if err := reaction.Deserialize(r); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions, nil
+}
+
+// MessageReaction is sent by clients to react to a message with an
+// emoji, or to take back their reaction if they reacted with it already
+type MessageReaction struct {
+	Serializable
+	Id    uint64
+	Emoji string
+}
+
+func (m *MessageReaction) ToBytes() ([]byte, error) {
+	return toBytes(m)
+}
+
+func (m *MessageReaction) FromBytes(data []byte) error {
+	return fromBytes(data, m)
+}
+
+func (m *MessageReaction) Serialize(w io.Writer) error {
+	if err := writeUint64(w, m.Id); err != nil {
+		return err
+	}
+	if err := writeString(w, m.Emoji); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *MessageReaction) Deserialize(r io.Reader) (err error) {
+	if m.Id, err = readUint64(r); err != nil {
+		return err
+	}
+	if m.Emoji, err = readString(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MessageReactions contains all reactions to a message,
+// which the server broadcasts whenever they change
+type MessageReactions struct {
+	Serializable
+	Id        uint64
+	Reactions []Reaction
+}
+
+func (m *MessageReactions) ToBytes() ([]byte, error) {
+	return toBytes(m)
+}
+
+func (m *MessageReactions) FromBytes(data []byte) error {
+	return fromBytes(data, m)
+}
+
+func (m *MessageReactions) Serialize(w io.Writer) error {
+	if err := writeUint64(w, m.Id); err != nil {
+		return err
+	}
+	return writeReactions(w, m.Reactions)
+}
+
+func (m *MessageReactions) Deserialize(r io.Reader) (err error) {
+	if m.Id, err = readUint64(r); err != nil {
+		return err
+	}
+	m.Reactions, err = readReactions(r)
+	return err
+}
+
+// Typing tells other users whether someone is writing a message.
+// Clients send it repeatedly while typing, and the server fills
+// in the name before relaying it.
+type Typing struct {
+	Serializable
+	Name   string
+	Active bool
+}
+
+func (t *Typing) ToBytes() ([]byte, error) {
+	return toBytes(t)
+}
+
+func (t *Typing) FromBytes(data []byte) error {
+	return fromBytes(data, t)
+}
+
+func (t *Typing) Serialize(w io.Writer) error {
+	if err := writeString(w, t.Name); err != nil {
+		return err
+	}
+	return writeBoolean(w, t.Active)
+}
+
+func (t *Typing) Deserialize(r io.Reader) (err error) {
+	if t.Name, err = readString(r); err != nil {
+		return err
+	}
+	t.Active, err = readBoolean(r)
+	return err
+}
+
+// Presence is the state of a user, along with an optional
+// message explaining why they are away
+type Presence struct {
+	Serializable
+	Name    string
+	State   PresenceState
+	Message string
+}
+
+func (p *Presence) ToBytes() ([]byte, error) {
+	return toBytes(p)
+}
+
+func (p *Presence) FromBytes(data []byte) error {
+	return fromBytes(data, p)
+}
+
+func (p *Presence) Serialize(w io.Writer) error {
+	if err := writeString(w, p.Name); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(p.State)); err != nil {
+		return err
+	}
+	return writeString(w, p.Message)
+}
+
+func (p *Presence) Deserialize(r io.Reader) (err error) {
+	if p.Name, err = readString(r); err != nil {
+		return err
+	}
+	var state uint8
+	if state, err = readUint8(r); err != nil {
+		return err
+	}
+	p.State = PresenceState(state)
+	p.Message, err = readString(r)
+	return err
+}
+
+// WhoisInfo describes a user connected to the server,
+// and is sent in response to a whois request
+type WhoisInfo struct {
+	Serializable
+	Name        string
+	ConnectedAt int64 // Unix time in milliseconds
+	Idle        int64 // Milliseconds since the user was last active
+	State       PresenceState
+	AwayMessage string
+	Client      string
+	Encrypted   bool
+}
+
+func (w *WhoisInfo) ToBytes() ([]byte, error) {
+	return toBytes(w)
+}
+
+func (w *WhoisInfo) FromBytes(data []byte) error {
+	return fromBytes(data, w)
+}
+
+func (w *WhoisInfo) Serialize(wr io.Writer) error {
+	if err := writeString(wr, w.Name); err != nil {
+		return err
+	}
+	if err := writeInt64(wr, w.ConnectedAt); err != nil {
+		return err
+	}
+	if err := writeInt64(wr, w.Idle); err != nil {
+		return err
+	}
+	if err := writeUint8(wr, uint8(w.State)); err != nil {
+		return err
+	}
+	if err := writeString(wr, w.AwayMessage); err != nil {
+		return err
+	}
+	if err := writeString(wr, w.Client); err != nil {
+		return err
+	}
+	return writeBoolean(wr, w.Encrypted)
+}
+
+func (w *WhoisInfo) Deserialize(r io.Reader) (err error) {
+	if w.Name, err = readString(r); err != nil {
+		return err
+	}
+	if w.ConnectedAt, err = readInt64(r); err != nil {
+		return err
+	}
+	if w.Idle, err = readInt64(r); err != nil {
+		return err
+	}
+	var state uint8
+	if state, err = readUint8(r); err != nil {
+		return err
+	}
+	w.State = PresenceState(state)
+	if w.AwayMessage, err = readString(r); err != nil {
+		return err
+	}
+	if w.Client, err = readString(r); err != nil {
+		return err
+	}
+	w.Encrypted, err = readBoolean(r)
+	return err
+}
+
+func writeStrings(w io.Writer, values []string) error {
+	if err := writeUint32(w, uint32(len(values))); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := writeString(w, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readStrings(r io.Reader) ([]string, error) {
+	length, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't trust the length for the allocation
+	values := make([]string, 0, min(length, 256))
+	for i := uint32(0); i < length; i++ {
+		value, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLinkEvent(t *testing.T) {
+	event := LinkEvent{
+		Id:       0x0102030405060708,
+		Origin:   "go-chat",
+		PacketId: PacketIdMessage,
+		Data:     []byte("payload"),
+	}
+
+	data, err := event.ToBytes()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	var decoded LinkEvent
+	if err := decoded.FromBytes(data); err != nil {
+		t.Fatalf("Deserialization failed: %v", err)
+	}
+
+	if decoded.Id != event.Id || decoded.Origin != event.Origin || decoded.PacketId != event.PacketId {
+		t.Fatalf("Decoded event does not match: got %+v, want %+v", decoded, event)
+	}
+	if !bytes.Equal(decoded.Data, event.Data) {
+		t.Fatalf("Decoded data does not match: got %q, want %q", decoded.Data, event.Data)
+	}
+
+	// A truncated event must not be accepted
+	if err := decoded.FromBytes(data[:len(data)-1]); err == nil {
+		t.Fatal("Expected error for truncated event")
+	}
+}
+
+func TestMessageReactions(t *testing.T) {
+	reactions := MessageReactions{
+		Id: 42,
+		Reactions: []Reaction{
+			{Emoji: "👍", Users: []string{"alice", "bob"}},
+			{Emoji: "🎉", Users: []string{"carol"}},
+		},
+	}
+
+	data, err := reactions.ToBytes()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	var decoded MessageReactions
+	if err := decoded.FromBytes(data); err != nil {
+		t.Fatalf("Deserialization failed: %v", err)
+	}
+
+	if decoded.Id != reactions.Id || len(decoded.Reactions) != 2 {
+		t.Fatalf("Decoded reactions do not match: got %+v, want %+v", decoded, reactions)
+	}
+	if decoded.Reactions[0].Emoji != "👍" || len(decoded.Reactions[0].Users) != 2 || decoded.Reactions[1].Users[0] != "carol" {
+		t.Fatalf("Decoded reactions do not match: got %+v, want %+v", decoded, reactions)
+	}
+}
+
+func TestWhoisInfo(t *testing.T) {
+	info := WhoisInfo{
+		Name:        "alice",
+		ConnectedAt: 1700000000000,
+		Idle:        90000,
+		State:       PresenceAway,
+		AwayMessage: "lunch",
+		Client:      "go-chat 1.0 (ECP v1)",
+		Encrypted:   true,
+	}
+
+	data, err := info.ToBytes()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	var decoded WhoisInfo
+	if err := decoded.FromBytes(data); err != nil {
+		t.Fatalf("Deserialization failed: %v", err)
+	}
+
+	if decoded.Name != info.Name || decoded.ConnectedAt != info.ConnectedAt || decoded.Idle != info.Idle ||
+		decoded.State != info.State || decoded.AwayMessage != info.AwayMessage || decoded.Client != info.Client ||
+		decoded.Encrypted != info.Encrypted {
+		t.Fatalf("Decoded info does not match: got %+v, want %+v", decoded, info)
+	}
+}
+
+func TestMessageOptionalFields(t *testing.T) {
+	message := Message{Sender: "alice", Content: "hello", Nonce: 7, Id: 42, ParentId: 3, Kind: MessageKindAction}
+
+	data, err := message.ToBytes()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	// Sender & content take 14 bytes, followed by three ids and the kind
+	tests := []struct {
+		name     string
+		length   int
+		expected Message
+		valid    bool
+	}{
+		{"content only", 14, Message{Sender: "alice", Content: "hello"}, true},
+		{"with nonce", 22, Message{Sender: "alice", Content: "hello", Nonce: 7}, true},
+		{"without kind", 38, Message{Sender: "alice", Content: "hello", Nonce: 7, Id: 42, ParentId: 3}, true},
+		{"complete", len(data), message, true},
+		{"truncated content", 13, Message{}, false},
+		{"truncated nonce", 18, Message{}, false},
+	}
+
+	for _, test := range tests {
+		var decoded Message
+		err := decoded.FromBytes(data[:test.length])
+
+		if !test.valid {
+			if err == nil {
+				t.Fatalf("Deserialization of %s succeeded, expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Deserialization of %s failed: %v", test.name, err)
+		}
+		if decoded != test.expected {
+			t.Fatalf("Decoded %s does not match: got %+v, want %+v", test.name, decoded, test.expected)
+		}
+	}
+}
+
+func TestHistoryBatchExtension(t *testing.T) {
+	message := HistoryMessage{Id: 1, Timestamp: 1700000000000, Sender: "alice", Content: "hello", ParentId: 5}
+	data, err := message.ToBytes()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	// A newer peer may append fields we don't know about yet
+	buffer := new(bytes.Buffer)
+	writeUint32(buffer, 2)
+	for i := 0; i < 2; i++ {
+		writeUint32(buffer, uint32(len(data)+2))
+		buffer.Write(data)
+		buffer.Write([]byte{0xff, 0xff})
+	}
+
+	var batch HistoryBatch
+	if err := batch.FromBytes(buffer.Bytes()); err != nil {
+		t.Fatalf("Deserialization failed: %v", err)
+	}
+	if len(batch.Messages) != 2 || batch.Messages[1].Content != "hello" || batch.Messages[1].ParentId != 5 {
+		t.Fatalf("Decoded batch does not match: got %+v", batch.Messages)
+	}
+}
+
+func TestNickname(t *testing.T) {
+	// Older clients only send their nickname
+	legacy := String{Value: "alice"}
+	data, err := legacy.ToBytes()
+	if err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+
+	var decoded Nickname
+	if err := decoded.FromBytes(data); err != nil {
+		t.Fatalf("Deserialization of legacy nickname failed: %v", err)
+	}
+	if decoded.Name != "alice" || decoded.Client != "" {
+		t.Fatalf("Decoded legacy nickname does not match: got %+v", decoded)
+	}
+
+	nickname := Nickname{Name: "alice", Client: "go-chat 1.0"}
+	if data, err = nickname.ToBytes(); err != nil {
+		t.Fatalf("Serialization failed: %v", err)
+	}
+	if err := decoded.FromBytes(data); err != nil {
+		t.Fatalf("Deserialization failed: %v", err)
+	}
+	if decoded != nickname {
+		t.Fatalf("Decoded nickname does not match: got %+v, want %+v", decoded, nickname)
+	}
+}
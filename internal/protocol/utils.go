@@ -127,6 +127,16 @@ func readString(r io.Reader) (string, error) {
 	return string(buf), nil
 }
 
+// optional accepts the end of the data in place of a field that
+// was added in a later version, since older peers don't send it.
+// Such fields, and all fields after them, keep their zero value.
+func optional(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
 func fromBytes(data []byte, s Serializable) error {
 	buffer := bytes.NewBuffer(data)
 	return s.Deserialize(buffer)
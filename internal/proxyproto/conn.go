@@ -0,0 +1,136 @@
+package proxyproto
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout is how long a proxy may take to send the header
+const DefaultHeaderTimeout = 5 * time.Second
+
+// Listener wraps connections from trusted proxies, so that their
+// RemoteAddr reports the address of the original client. Connections
+// from other sources are passed through without reading a header.
+type Listener struct {
+	net.Listener
+	Trusted []*net.IPNet
+	Timeout time.Duration
+}
+
+func NewListener(listener net.Listener, trusted []*net.IPNet) *Listener {
+	return &Listener{
+		Listener: listener,
+		Trusted:  trusted,
+		Timeout:  DefaultHeaderTimeout,
+	}
+}
+
+func (listener *Listener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !listener.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return NewConn(conn, listener.Timeout), nil
+}
+
+func (listener *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range listener.Trusted {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection that starts with a PROXY protocol header.
+// The header is read on first use instead of in Accept, so that
+// a slow proxy can't block other connections from being accepted.
+type Conn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+}
+
+func NewConn(conn net.Conn, timeout time.Duration) *Conn {
+	return &Conn{Conn: conn, timeout: timeout}
+}
+
+// Header returns the header sent by the proxy, reading it if necessary
+func (c *Conn) Header() (*Header, error) {
+	c.once.Do(c.readHeader)
+	return c.header, c.err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if _, err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// RemoteAddr returns the address of the original client, or the
+// address of the proxy if the header did not contain one
+func (c *Conn) RemoteAddr() net.Addr {
+	header, err := c.Header()
+	if err != nil || header.Source == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return header.Source
+}
+
+// CloseWrite shuts down the writing side, if the underlying connection supports it
+func (c *Conn) CloseWrite() error {
+	if closer, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+func (c *Conn) readHeader() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.header, c.err = ReadHeader(c.Conn)
+}
+
+// ParseNetworks parses a list of CIDR networks,
+// where single IP addresses are also accepted
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address '%s'", value)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s'", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,165 @@
+// Package proxyproto implements the receiving side of the PROXY
+// protocol (version 1 and 2), which load balancers like HAProxy
+// use to pass on the address of the original client.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// v2Signature starts every binary (version 2) header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxV1Length is the maximum length of a text header, including the CRLF
+const maxV1Length = 107
+
+var ErrInvalidHeader = errors.New("proxyproto: invalid header")
+
+// Header describes the connection as seen by the proxy
+type Header struct {
+	Version int
+
+	// Source & Destination are nil for connections that were
+	// opened by the proxy itself, e.g. for health checks
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// ReadHeader reads a version 1 or 2 header from the reader. It
+// never reads past the end of the header, so the remaining data
+// can be read from the same reader afterwards.
+func ReadHeader(r io.Reader) (*Header, error) {
+	prefix := make([]byte, len(v2Signature))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(prefix, v2Signature) {
+		return readV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return readV1(r, prefix)
+	}
+	return nil, ErrInvalidHeader
+}
+
+func readV1(r io.Reader, prefix []byte) (*Header, error) {
+	line := prefix
+	next := make([]byte, 1)
+
+	// Read byte by byte, to avoid consuming any data after the header
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1Length {
+			return nil, ErrInvalidHeader
+		}
+		if _, err := io.ReadFull(r, next); err != nil {
+			return nil, err
+		}
+		line = append(line, next[0])
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	header := &Header{Version: 1}
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		// The proxy doesn't know the addresses, so we use our own
+		return header, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidHeader
+	}
+
+	source, err := parseV1Address(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	destination, err := parseV1Address(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	header.Source = source
+	header.Destination = destination
+	return header, nil
+}
+
+func parseV1Address(host string, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: bad address '%s'", ErrInvalidHeader, host)
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad port '%s'", ErrInvalidHeader, port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(portNumber)}, nil
+}
+
+func readV2(r io.Reader) (*Header, error) {
+	fixed := make([]byte, 4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	version, command := fixed[0]>>4, fixed[0]&0x0F
+	family := fixed[1]
+	length := binary.BigEndian.Uint16(fixed[2:])
+
+	if version != 2 {
+		return nil, ErrInvalidHeader
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	header := &Header{Version: 2}
+
+	switch command {
+	case 0x0:
+		// LOCAL: the connection was opened by the proxy itself
+		return header, nil
+	case 0x1:
+		// PROXY: the addresses follow
+	default:
+		return nil, ErrInvalidHeader
+	}
+
+	switch family >> 4 {
+	case 0x1:
+		// AF_INET: 4 byte addresses & 2 byte ports
+		if len(payload) < 12 {
+			return nil, ErrInvalidHeader
+		}
+		header.Source = v2Address(family, payload[0:4], payload[8:10])
+		header.Destination = v2Address(family, payload[4:8], payload[10:12])
+	case 0x2:
+		// AF_INET6: 16 byte addresses & 2 byte ports
+		if len(payload) < 36 {
+			return nil, ErrInvalidHeader
+		}
+		header.Source = v2Address(family, payload[0:16], payload[32:34])
+		header.Destination = v2Address(family, payload[16:32], payload[34:36])
+	default:
+		// Unix sockets & unspecified families carry no
+		// useful address, any TLVs are ignored as well
+	}
+	return header, nil
+}
+
+func v2Address(family byte, ip []byte, port []byte) net.Addr {
+	address := net.IP(bytes.Clone(ip))
+	portNumber := int(binary.BigEndian.Uint16(port))
+
+	if family&0x0F == 0x2 {
+		return &net.UDPAddr{IP: address, Port: portNumber}
+	}
+	return &net.TCPAddr{IP: address, Port: portNumber}
+}
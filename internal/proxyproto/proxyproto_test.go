@@ -0,0 +1,120 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+func v2Header(command byte, family byte, payload []byte) []byte {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func TestReadHeader(t *testing.T) {
+	ipv4Payload := []byte{
+		192, 168, 0, 1, // source
+		10, 0, 0, 1, // destination
+		0x30, 0x39, // source port 12345
+		0x1F, 0x90, // destination port 8080
+	}
+
+	tests := []struct {
+		name   string
+		input  []byte
+		source string
+		err    bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 8080\r\n"), "192.168.0.1:12345", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 8080\r\n"), "[2001:db8::1]:12345", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 bad address", []byte("PROXY TCP4 nowhere 10.0.0.1 12345 8080\r\n"), "", true},
+		{"v1 too long", append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), 120)...), "", true},
+		{"v2 tcp4", v2Header(0x1, 0x11, ipv4Payload), "192.168.0.1:12345", false},
+		{"v2 local", v2Header(0x0, 0x00, nil), "", false},
+		{"v2 truncated", v2Header(0x1, 0x11, ipv4Payload[:6]), "", true},
+		{"no header", []byte("\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), "", true},
+	}
+
+	for _, test := range tests {
+		// Data after the header must be left untouched
+		reader := bytes.NewReader(append(test.input, "data"...))
+		header, err := ReadHeader(reader)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReadHeader failed: %v", test.name, err)
+			continue
+		}
+
+		source := ""
+		if header.Source != nil {
+			source = header.Source.String()
+		}
+		if source != test.source {
+			t.Errorf("%s: source is %q, want %q", test.name, source, test.source)
+		}
+
+		rest, _ := io.ReadAll(reader)
+		if string(rest) != "data" {
+			t.Errorf("%s: remaining data is %q, want %q", test.name, rest, "data")
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		client.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 4000 8080\r\nhello"))
+	}()
+
+	conn := NewConn(server, DefaultHeaderTimeout)
+	if address := conn.RemoteAddr().String(); address != "203.0.113.7:4000" {
+		t.Fatalf("RemoteAddr returned %q, want %q", address, "203.0.113.7:4000")
+	}
+
+	data := make([]byte, 5)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("Read returned %q, want %q", data, "hello")
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "127.0.0.1", "::1"})
+	if err != nil {
+		t.Fatalf("ParseNetworks failed: %v", err)
+	}
+
+	listener := &Listener{Trusted: networks}
+	trusted := []string{"10.1.2.3", "127.0.0.1", "::1"}
+	untrusted := []string{"192.168.0.1", "127.0.0.2"}
+
+	for _, ip := range trusted {
+		if !listener.isTrusted(&net.TCPAddr{IP: net.ParseIP(ip)}) {
+			t.Errorf("%s should be trusted", ip)
+		}
+	}
+	for _, ip := range untrusted {
+		if listener.isTrusted(&net.TCPAddr{IP: net.ParseIP(ip)}) {
+			t.Errorf("%s should not be trusted", ip)
+		}
+	}
+
+	if _, err := ParseNetworks([]string{"not an address"}); err == nil {
+		t.Fatal("Expected error for invalid address")
+	}
+}
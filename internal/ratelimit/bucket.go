@@ -0,0 +1,45 @@
+// Package ratelimit implements a token bucket, which allows short
+// bursts of events while limiting their average rate over time.
+package ratelimit
+
+import "time"
+
+// Bucket holds up to Burst tokens and gains Rate tokens per second.
+// Every allowed event takes one token. It is not safe for concurrent use.
+type Bucket struct {
+	Rate  float64
+	Burst int
+
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{
+		Rate:   rate,
+		Burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token, if one is available
+func (b *Bucket) Allow() bool {
+	return b.AllowAt(time.Now())
+}
+
+// AllowAt takes a token at the given time, if one is available
+func (b *Bucket) AllowAt(now time.Time) bool {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.Rate
+		b.last = now
+	}
+	b.tokens = min(b.tokens, float64(b.Burst))
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	bucket := NewBucket(2, 3)
+	now := bucket.last
+
+	for i := 0; i < 3; i++ {
+		if !bucket.AllowAt(now) {
+			t.Fatalf("Event %d within burst was not allowed", i+1)
+		}
+	}
+	if bucket.AllowAt(now) {
+		t.Fatal("Event after burst was allowed")
+	}
+
+	// Two tokens per second means one every 500ms
+	if !bucket.AllowAt(now.Add(500 * time.Millisecond)) {
+		t.Fatal("Event after refill was not allowed")
+	}
+	if bucket.AllowAt(now.Add(600 * time.Millisecond)) {
+		t.Fatal("Event before refill was allowed")
+	}
+
+	// The bucket never holds more than the burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		bucket.AllowAt(later)
+	}
+	if bucket.AllowAt(later) {
+		t.Fatal("Bucket exceeded its burst")
+	}
+}
@@ -0,0 +1,107 @@
+// Package sanitize removes terminal control sequences from text,
+// which would otherwise let users manipulate other users' terminals.
+package sanitize
+
+import "strings"
+
+const (
+	esc = '\x1b'
+	bel = '\x07'
+
+	// C1 control characters, which some terminals
+	// interpret like their escape sequence equivalent
+	csi = '\u009b'
+	osc = '\u009d'
+	dcs = '\u0090'
+	st  = '\u009c'
+)
+
+// HasControl reports whether the text contains control characters
+// other than newlines and tabs, including escape sequences
+func HasControl(text string) bool {
+	for _, r := range text {
+		if isControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// StripControl removes escape sequences entirely, along with any
+// other control characters except for newlines and tabs
+func StripControl(text string) string {
+	if !HasControl(text) {
+		return text
+	}
+
+	runes := []rune(text)
+	var builder strings.Builder
+	builder.Grow(len(text))
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == esc:
+			i = skipEscape(runes, i)
+		case r == csi:
+			i = skipCSI(runes, i+1)
+		case r == osc || r == dcs:
+			i = skipString(runes, i+1)
+		case isControl(r):
+			// Drop single control characters
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func isControl(r rune) bool {
+	if r == '\n' || r == '\t' {
+		return false
+	}
+	return r < 0x20 || (r >= 0x7f && r <= 0x9f)
+}
+
+// skipEscape returns the index of the last rune of the
+// escape sequence, which starts at the given index
+func skipEscape(runes []rune, start int) int {
+	if start+1 >= len(runes) {
+		return start
+	}
+
+	switch runes[start+1] {
+	case '[':
+		return skipCSI(runes, start+2)
+	case ']', 'P', 'X', '^', '_':
+		return skipString(runes, start+2)
+	default:
+		// Two character sequences, e.g. "ESC c" which resets the terminal
+		return start + 1
+	}
+}
+
+// skipCSI skips parameters & intermediate bytes up to the final byte
+func skipCSI(runes []rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] >= 0x40 && runes[i] <= 0x7e {
+			return i
+		}
+	}
+	return len(runes) - 1
+}
+
+// skipString skips a control string, e.g. a window title, which
+// ends with a bell, a string terminator or the end of the text
+func skipString(runes []rune, start int) int {
+	for i := start; i < len(runes); i++ {
+		switch {
+		case runes[i] == bel || runes[i] == st:
+			return i
+		case runes[i] == esc && i+1 < len(runes) && runes[i+1] == '\\':
+			return i + 1
+		}
+	}
+	return len(runes) - 1
+}
@@ -0,0 +1,41 @@
+package sanitize
+
+import "testing"
+
+func TestStripControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"hello world", "hello world"},
+		{"multiple\nlines\tand tabs", "multiple\nlines\tand tabs"},
+		{"\x1b[31mred\x1b[0m text", "red text"},
+		{"\x1b[2J\x1b[Hcleared", "cleared"},
+		{"\x1b]0;new title\x07after", "after"},
+		{"\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"\x1bcreset", "reset"},
+		{"\u009b31mc1 csi", "c1 csi"},
+		{"carriage\rreturn\x00", "carriagereturn"},
+		{"bell\x07", "bell"},
+		{"dangling \x1b[", "dangling "},
+		{"ünïcödé ✓", "ünïcödé ✓"},
+	}
+
+	for _, test := range tests {
+		if result := StripControl(test.input); result != test.expected {
+			t.Errorf("StripControl(%q) = %q, want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestHasControl(t *testing.T) {
+	if HasControl("plain\ntext\twith tabs") {
+		t.Error("Plain text was reported to contain control characters")
+	}
+	if !HasControl("\x1b[31mred") {
+		t.Error("Escape sequence was not detected")
+	}
+	if !HasControl("c1\u009b") {
+		t.Error("C1 control character was not detected")
+	}
+}
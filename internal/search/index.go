@@ -0,0 +1,210 @@
+// Package search implements an in-memory inverted index over chat
+// messages, which answers queries by words, sender and time range.
+package search
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Query describes the messages to find. All words have to be contained
+// in a message, while empty fields and zero times are ignored.
+type Query struct {
+	Words  []string
+	Sender string
+	After  time.Time
+	Before time.Time
+}
+
+type document struct {
+	sender    string
+	timestamp time.Time
+	terms     []string
+}
+
+// Index maps words to the ids of the messages containing them
+type Index struct {
+	postings  map[string][]uint64
+	documents map[uint64]document
+	mutex     sync.RWMutex
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings:  make(map[string][]uint64),
+		documents: make(map[uint64]document),
+	}
+}
+
+// Add indexes a message under all of its words, replacing
+// what was indexed before if the message was added already
+func (index *Index) Add(id uint64, sender string, timestamp time.Time, content string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.remove(id)
+
+	terms := uniqueTerms(content)
+	index.documents[id] = document{
+		sender:    strings.ToLower(sender),
+		timestamp: timestamp,
+		terms:     terms,
+	}
+
+	for _, term := range terms {
+		postings := index.postings[term]
+
+		// Messages are usually added in order, except for edits
+		if len(postings) == 0 || postings[len(postings)-1] < id {
+			index.postings[term] = append(postings, id)
+			continue
+		}
+		position, _ := slices.BinarySearch(postings, id)
+		index.postings[term] = slices.Insert(postings, position, id)
+	}
+}
+
+// Remove drops a message from the index, e.g. after it was deleted
+func (index *Index) Remove(id uint64) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.remove(id)
+}
+
+func (index *Index) remove(id uint64) {
+	document, ok := index.documents[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range document.terms {
+		postings := index.postings[term]
+		position, found := slices.BinarySearch(postings, id)
+		if !found {
+			continue
+		}
+
+		postings = slices.Delete(postings, position, position+1)
+		if len(postings) == 0 {
+			delete(index.postings, term)
+			continue
+		}
+		index.postings[term] = postings
+	}
+	delete(index.documents, id)
+}
+
+// RemoveBefore drops all messages with a lower id than the given
+// one, e.g. after they were deleted from the history by retention
+func (index *Index) RemoveBefore(id uint64) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	for documentId := range index.documents {
+		if documentId < id {
+			index.remove(documentId)
+		}
+	}
+}
+
+// Len returns the number of indexed messages
+func (index *Index) Len() int {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return len(index.documents)
+}
+
+// Search returns the ids of up to limit matching messages, newest first
+func (index *Index) Search(query Query, limit int) []uint64 {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	candidates := index.candidates(query.Words)
+	sender := strings.ToLower(query.Sender)
+	results := make([]uint64, 0, min(limit, len(candidates)))
+
+	for i := len(candidates) - 1; i >= 0 && len(results) < limit; i-- {
+		document := index.documents[candidates[i]]
+
+		if sender != "" && document.sender != sender {
+			continue
+		}
+		if !query.After.IsZero() && document.timestamp.Before(query.After) {
+			continue
+		}
+		if !query.Before.IsZero() && !document.timestamp.Before(query.Before) {
+			continue
+		}
+		results = append(results, candidates[i])
+	}
+	return results
+}
+
+// candidates returns the ids of all messages that contain
+// every word, or of all messages if there are no words
+func (index *Index) candidates(words []string) []uint64 {
+	terms := uniqueTerms(strings.Join(words, " "))
+
+	if len(terms) == 0 {
+		ids := make([]uint64, 0, len(index.documents))
+		for id := range index.documents {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	lists := make([][]uint64, 0, len(terms))
+	for _, term := range terms {
+		postings, ok := index.postings[term]
+		if !ok {
+			return nil
+		}
+		lists = append(lists, postings)
+	}
+
+	// Start with the rarest word, to keep the intersection small
+	slices.SortFunc(lists, func(a, b []uint64) int { return len(a) - len(b) })
+
+	result := slices.Clone(lists[0])
+	for _, list := range lists[1:] {
+		result = intersect(result, list)
+	}
+	return result
+}
+
+func intersect(a, b []uint64) []uint64 {
+	result := a[:0]
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Tokenize splits text into lowercase words, where
+// everything but letters and digits separates words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func uniqueTerms(text string) []string {
+	terms := Tokenize(text)
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Check https://Example.com/docs, it's great!")
+	expected := []string{"check", "https", "example", "com", "docs", "it", "s", "great"}
+
+	if !slices.Equal(tokens, expected) {
+		t.Fatalf("Tokenize returned %v, want %v", tokens, expected)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	start := time.Date(2026, 10, 13, 12, 0, 0, 0, time.UTC)
+	index := NewIndex()
+
+	index.Add(1, "alice", start, "Here is the link: https://example.com")
+	index.Add(2, "bob", start.Add(time.Hour), "Thanks for the link!")
+	index.Add(3, "alice", start.Add(24*time.Hour), "Another link to example.com")
+	index.Add(4, "carol", start.Add(48*time.Hour), "Unrelated message")
+
+	tests := []struct {
+		name     string
+		query    Query
+		expected []uint64
+	}{
+		{"single word", Query{Words: []string{"link"}}, []uint64{3, 2, 1}},
+		{"multiple words", Query{Words: []string{"example", "LINK"}}, []uint64{3, 1}},
+		{"phrase", Query{Words: []string{"example.com"}}, []uint64{3, 1}},
+		{"sender", Query{Words: []string{"link"}, Sender: "Alice"}, []uint64{3, 1}},
+		{"time range", Query{Words: []string{"link"}, After: start.Add(time.Minute), Before: start.Add(25 * time.Hour)}, []uint64{3, 2}},
+		{"only filters", Query{Sender: "carol"}, []uint64{4}},
+		{"unknown word", Query{Words: []string{"link", "nothing"}}, []uint64{}},
+	}
+
+	for _, test := range tests {
+		results := index.Search(test.query, 10)
+		if !slices.Equal(results, test.expected) {
+			t.Errorf("%s: Search returned %v, want %v", test.name, results, test.expected)
+		}
+	}
+
+	if results := index.Search(Query{Words: []string{"link"}}, 1); !slices.Equal(results, []uint64{3}) {
+		t.Errorf("Search with limit returned %v, want [3]", results)
+	}
+}
+
+func TestIndexChanges(t *testing.T) {
+	index := NewIndex()
+	now := time.Now()
+
+	index.Add(1, "alice", now, "first link")
+	index.Add(2, "bob", now, "second link")
+	index.Add(3, "alice", now, "third link")
+	index.Add(4, "carol", now, "fourth link")
+
+	// Editing a message replaces its words
+	index.Add(1, "alice", now, "first message")
+	index.Remove(2)
+
+	// Retention deleted the oldest messages from the history
+	index.RemoveBefore(3)
+
+	tests := []struct {
+		word     string
+		expected []uint64
+	}{
+		{"link", []uint64{4, 3}},
+		{"message", []uint64{}},
+		{"second", []uint64{}},
+	}
+
+	for _, test := range tests {
+		results := index.Search(Query{Words: []string{test.word}}, 10)
+		if !slices.Equal(results, test.expected) {
+			t.Errorf("%s: Search returned %v, want %v", test.word, results, test.expected)
+		}
+	}
+
+	if index.Len() != 2 {
+		t.Errorf("Len returned %d, want 2", index.Len())
+	}
+}
@@ -1 +1,155 @@
 package tcp
+
+import (
+	"github.com/Lekuruu/go-chat/internal/logging"
+	"github.com/Lekuruu/go-chat/internal/transport"
+
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// RetryPolicy controls how often and how fast a client
+// tries to reconnect after a failed connection attempt
+type RetryPolicy struct {
+	// MaxAttempts is the total number of connection attempts,
+	// where zero or less means that the client retries forever
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy tries to connect three times with a short backoff
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+// Backoff returns the delay before the given attempt, starting at 1
+func (policy RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(policy.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= policy.Multiplier
+		if policy.MaxBackoff > 0 && backoff >= float64(policy.MaxBackoff) {
+			return policy.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+type Client struct {
+	Name        string
+	Host        string
+	Port        int
+	Logger      *logging.Logger
+	DialTimeout time.Duration
+	KeepAlive   time.Duration
+	Retry       RetryPolicy
+
+	// Endpoint is an optional URL-style address, e.g.
+	// "unix:///run/chat.sock", which overrides Host and Port
+	Endpoint string
+
+	// TLSConfig enables TLS on top of the transport, if set
+	TLSConfig *tls.Config
+
+	requestHandler func(net.Conn)
+}
+
+func NewClient(name string, host string, port int, handler func(net.Conn)) *Client {
+	return &Client{
+		Name:           name,
+		Host:           host,
+		Port:           port,
+		Logger:         logging.CreateLogger(name, logging.INFO),
+		DialTimeout:    10 * time.Second,
+		KeepAlive:      30 * time.Second,
+		Retry:          DefaultRetryPolicy,
+		requestHandler: handler,
+	}
+}
+
+func (client *Client) Bind() string {
+	return net.JoinHostPort(client.Host, fmt.Sprintf("%d", client.Port))
+}
+
+// ResolveEndpoint returns the endpoint the client connects to
+func (client *Client) ResolveEndpoint() (transport.Endpoint, error) {
+	if client.Endpoint != "" {
+		return transport.ParseEndpoint(client.Endpoint)
+	}
+	return transport.Endpoint{Scheme: "tcp", Address: client.Bind()}, nil
+}
+
+// Dial connects to the configured address, retrying according
+// to the retry policy until it succeeds or the context is done
+func (client *Client) Dial(ctx context.Context) (net.Conn, error) {
+	endpoint, err := client.ResolveEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   client.DialTimeout,
+		KeepAlive: client.KeepAlive,
+	}
+
+	for attempt := 1; ; attempt++ {
+		conn, err := client.dial(ctx, dialer, endpoint)
+		if err == nil {
+			return conn, nil
+		}
+
+		if client.Retry.MaxAttempts > 0 && attempt >= client.Retry.MaxAttempts {
+			return nil, err
+		}
+
+		backoff := client.Retry.Backoff(attempt)
+		client.Logger.Warningf("Failed to connect to '%s': %v (retrying in %s)", endpoint, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (client *Client) dial(ctx context.Context, dialer *net.Dialer, endpoint transport.Endpoint) (net.Conn, error) {
+	conn, err := transport.Dial(ctx, dialer, endpoint)
+	if err != nil || client.TLSConfig == nil {
+		return conn, err
+	}
+
+	// Don't let a stalled handshake exceed the dial timeout
+	if dialer.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(dialer.Timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	tlsConn := tls.Client(conn, client.TLSConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Run connects to the server and passes the connection to the
+// handler, closing it once the handler returns
+func (client *Client) Run(ctx context.Context) error {
+	conn, err := client.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client.Logger.Infof("Connected to '%s'", conn.RemoteAddr())
+	client.requestHandler(conn)
+	return nil
+}
@@ -0,0 +1,152 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/logging"
+	"github.com/Lekuruu/go-chat/internal/protocol"
+	"github.com/Lekuruu/go-chat/internal/transport"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		300 * time.Millisecond,
+		300 * time.Millisecond,
+	}
+
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	received := make(chan struct{})
+	server, _ := startServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		buf := make([]byte, 4)
+		conn.Read(buf)
+		close(received)
+	}, nil)
+	defer server.Shutdown(context.Background())
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	client := NewClient("test", "127.0.0.1", portNumber, func(conn net.Conn) {
+		conn.Write([]byte("ping"))
+		<-received
+	})
+	client.Logger.SetLevel(logging.QUIET)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := client.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	// Reserve a port and release it again, so nothing is listening
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	client := NewClient("test", "127.0.0.1", port, nil)
+	client.Logger.SetLevel(logging.QUIET)
+	client.Retry = RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	start := time.Now()
+	if _, err := client.Dial(context.Background()); err == nil {
+		t.Fatal("Expected dial to fail")
+	}
+
+	// Two backoffs between three attempts: 10ms + 20ms
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("Dial returned after %s, expected it to back off", elapsed)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	certPEM, keyPEM, err := transport.GenerateCertificate([]string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{certificate}}
+
+	key := []byte("A0KWJW3qRCiYcEj3")
+	content := []byte("encrypted inside tls")
+
+	// Echo back every ECP packet, which should still be AES encrypted
+	server, _ := startServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		packet, err := protocol.DeserializePacket(conn, key)
+		if err != nil {
+			return
+		}
+		packet.Serialize(conn, key)
+	}, serverConfig)
+	defer server.Shutdown(context.Background())
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	clientConfig, err := transport.ClientTLSConfig("127.0.0.1", "", transport.CertificateFingerprint(serverConfig))
+	if err != nil {
+		t.Fatalf("Failed to create client config: %v", err)
+	}
+
+	client := NewClient("test", "127.0.0.1", portNumber, nil)
+	client.Logger.SetLevel(logging.QUIET)
+	client.TLSConfig = clientConfig
+
+	conn, err := client.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if _, ok := conn.(*tls.Conn); !ok {
+		t.Fatalf("Expected a TLS connection, got %T", conn)
+	}
+
+	packet := protocol.NewPacket(1, protocol.PacketIdMessage, protocol.EncryptionTypeAES, content)
+	if err := packet.Serialize(conn, key); err != nil {
+		t.Fatalf("Failed to send packet: %v", err)
+	}
+
+	response, err := protocol.DeserializePacket(conn, key)
+	if err != nil {
+		t.Fatalf("Failed to read packet: %v", err)
+	}
+	if string(response.Data) != string(content) {
+		t.Fatalf("Received %q, want %q", response.Data, content)
+	}
+}
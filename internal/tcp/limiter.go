@@ -0,0 +1,151 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTooManyConnections      = errors.New("tcp: too many connections")
+	ErrTooManyConnectionsForIP = errors.New("tcp: too many connections from this address")
+	ErrConnectionRateExceeded  = errors.New("tcp: connection rate exceeded")
+)
+
+// RateWindow is the period in which new connections are counted
+// for the MaxConnectionRate limit
+const RateWindow = time.Minute
+
+// Limits restricts how many connections are accepted, where
+// a value of zero disables the respective limit
+type Limits struct {
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	// MaxConnectionRate is the number of new
+	// connections per address within RateWindow
+	MaxConnectionRate int
+}
+
+// Limiter keeps track of active connections and enforces the limits.
+// It can be shared by multiple servers, to apply the limits globally.
+type Limiter struct {
+	limits    Limits
+	active    int
+	perIP     map[string]int
+	attempts  map[string][]time.Time
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:   limits,
+		perIP:    make(map[string]int),
+		attempts: make(map[string][]time.Time),
+	}
+}
+
+// SetLimits replaces the limits, which only affects new connections
+func (limiter *Limiter) SetLimits(limits Limits) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.limits = limits
+}
+
+// Acquire reserves a slot for a connection from the given address,
+// which has to be returned with Release once the connection is closed
+func (limiter *Limiter) Acquire(addr net.Addr) error {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	limiter.sweep(now)
+	ip, hasIP := addressKey(addr)
+
+	if hasIP && limiter.limits.MaxConnectionRate > 0 {
+		attempts := recentAttempts(limiter.attempts[ip], now)
+		limiter.attempts[ip] = attempts
+
+		if len(attempts) >= limiter.limits.MaxConnectionRate {
+			return ErrConnectionRateExceeded
+		}
+		limiter.attempts[ip] = append(attempts, now)
+	}
+
+	if limiter.limits.MaxConnections > 0 && limiter.active >= limiter.limits.MaxConnections {
+		return ErrTooManyConnections
+	}
+
+	if hasIP && limiter.limits.MaxConnectionsPerIP > 0 && limiter.perIP[ip] >= limiter.limits.MaxConnectionsPerIP {
+		return ErrTooManyConnectionsForIP
+	}
+
+	limiter.active++
+	if hasIP {
+		limiter.perIP[ip]++
+	}
+	return nil
+}
+
+// Release frees the slot of a connection, that was acquired before
+func (limiter *Limiter) Release(addr net.Addr) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.active--
+
+	ip, hasIP := addressKey(addr)
+	if !hasIP {
+		return
+	}
+
+	limiter.perIP[ip]--
+	if limiter.perIP[ip] <= 0 {
+		delete(limiter.perIP, ip)
+	}
+}
+
+// sweep forgets the attempts of addresses that didn't
+// connect recently, so the map doesn't grow forever
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < RateWindow {
+		return
+	}
+	limiter.lastSweep = now
+
+	for ip, attempts := range limiter.attempts {
+		attempts = recentAttempts(attempts, now)
+		if len(attempts) == 0 {
+			delete(limiter.attempts, ip)
+			continue
+		}
+		limiter.attempts[ip] = attempts
+	}
+}
+
+func recentAttempts(attempts []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-RateWindow)
+	for len(attempts) > 0 && !attempts[0].After(cutoff) {
+		attempts = attempts[1:]
+	}
+	return attempts
+}
+
+// addressKey returns the IP of an address, if it has one.
+// Connections over unix sockets are not limited per address.
+func addressKey(addr net.Addr) (string, bool) {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP.String(), true
+	case *net.UDPAddr:
+		return addr.IP.String(), true
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil || net.ParseIP(host) == nil {
+		return "", false
+	}
+	return host, true
+}
@@ -0,0 +1,55 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestLimiter(t *testing.T) {
+	first := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	second := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 1000}
+	third := &net.TCPAddr{IP: net.ParseIP("192.0.2.3"), Port: 1000}
+
+	limiter := NewLimiter(Limits{MaxConnections: 3, MaxConnectionsPerIP: 2})
+
+	for _, addr := range []net.Addr{first, first, second} {
+		if err := limiter.Acquire(addr); err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+	}
+
+	if err := limiter.Acquire(third); !errors.Is(err, ErrTooManyConnections) {
+		t.Fatalf("Acquire returned %v, want %v", err, ErrTooManyConnections)
+	}
+
+	limiter.Release(second)
+	if err := limiter.Acquire(first); !errors.Is(err, ErrTooManyConnectionsForIP) {
+		t.Fatalf("Acquire returned %v, want %v", err, ErrTooManyConnectionsForIP)
+	}
+	if err := limiter.Acquire(third); err != nil {
+		t.Fatalf("Acquire failed after release: %v", err)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	limiter := NewLimiter(Limits{MaxConnectionRate: 2})
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Acquire(addr); err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+		limiter.Release(addr)
+	}
+
+	// Closed connections still count towards the rate
+	if err := limiter.Acquire(addr); !errors.Is(err, ErrConnectionRateExceeded) {
+		t.Fatalf("Acquire returned %v, want %v", err, ErrConnectionRateExceeded)
+	}
+
+	// Unix sockets have no address to limit
+	if err := limiter.Acquire(&net.UnixAddr{Name: "@", Net: "unix"}); err != nil {
+		t.Fatalf("Acquire failed for unix socket: %v", err)
+	}
+}
@@ -2,19 +2,58 @@ package tcp
 
 import (
 	"github.com/Lekuruu/go-chat/internal/logging"
+	"github.com/Lekuruu/go-chat/internal/proxyproto"
+	"github.com/Lekuruu/go-chat/internal/transport"
 
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sync"
+	"time"
 )
 
+// ErrServerClosed is returned by Run after Shutdown has been called
+var ErrServerClosed = errors.New("tcp: server closed")
+
+// RejectTimeout bounds the time spent on telling
+// a rejected client why it can't connect
+const RejectTimeout = 2 * time.Second
+
 type Server struct {
 	Name   string
 	Host   string
 	Port   int
 	Logger *logging.Logger
 
+	// Endpoint is an optional URL-style address, e.g.
+	// "unix:///run/chat.sock", which overrides Host and Port
+	Endpoint string
+
+	// TLSConfig enables TLS on top of the transport, if set
+	TLSConfig *tls.Config
+
+	// TrustedProxies are the networks of load balancers, which
+	// send a PROXY protocol header in front of every connection
+	TrustedProxies []*net.IPNet
+
+	// Limiter restricts the number of connections, if set
+	Limiter *Limiter
+
+	// RejectHandler is called for connections that exceed a limit,
+	// before they are closed, e.g. to send an error message
+	RejectHandler func(net.Conn, error)
+
 	listener       net.Listener
 	requestHandler func(net.Conn)
+
+	mutex            sync.Mutex
+	connections      map[net.Conn]struct{}
+	handlers         sync.WaitGroup
+	shutdownHandlers []func(context.Context)
+	shuttingDown     bool
 }
 
 func NewServer(name string, host string, port int, handler func(net.Conn)) *Server {
@@ -24,6 +63,7 @@ func NewServer(name string, host string, port int, handler func(net.Conn)) *Serv
 		Port:           port,
 		Logger:         logging.CreateLogger(name, logging.INFO),
 		requestHandler: handler,
+		connections:    make(map[net.Conn]struct{}),
 	}
 }
 
@@ -31,20 +71,192 @@ func (server *Server) Bind() string {
 	return fmt.Sprintf("%s:%d", server.Host, server.Port)
 }
 
+// ResolveEndpoint returns the endpoint the server listens on
+func (server *Server) ResolveEndpoint() (transport.Endpoint, error) {
+	if server.Endpoint != "" {
+		return transport.ParseEndpoint(server.Endpoint)
+	}
+	return transport.Endpoint{Scheme: "tcp", Address: server.Bind()}, nil
+}
+
 func (server *Server) Run() error {
-	listener, err := net.Listen("tcp", server.Bind())
+	endpoint, err := server.ResolveEndpoint()
+	if err != nil {
+		return err
+	}
+
+	// The header is sent before the TLS handshake, and
+	// before the upgrade of websocket connections
+	listener, err := transport.ListenWrapped(endpoint, func(listener net.Listener) net.Listener {
+		if len(server.TrustedProxies) == 0 {
+			return listener
+		}
+		return proxyproto.NewListener(listener, server.TrustedProxies)
+	})
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
+
+	if server.TLSConfig != nil {
+		listener = tls.NewListener(listener, server.TLSConfig)
+	}
+
+	server.mutex.Lock()
+	if server.shuttingDown {
+		server.mutex.Unlock()
+		return ErrServerClosed
+	}
 	server.listener = listener
-	server.Logger.Infof("Listening on '%s' ...", server.Bind())
+	server.mutex.Unlock()
+	server.Logger.Infof("Listening on '%s' ...", endpoint)
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if server.IsShuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
-		go server.requestHandler(conn)
+
+		if !server.trackConnection(conn) {
+			// Shutdown started while we were accepting
+			conn.Close()
+			return ErrServerClosed
+		}
+		go server.serve(conn)
+	}
+}
+
+// Addr returns the address the server is listening on,
+// or nil if the server is not running yet
+func (server *Server) Addr() net.Addr {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.listener == nil {
+		return nil
+	}
+	return server.listener.Addr()
+}
+
+// IsShuttingDown reports whether Shutdown has been called
+func (server *Server) IsShuttingDown() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.shuttingDown
+}
+
+// RegisterOnShutdown registers a function to be called once Shutdown
+// has stopped accepting new connections, but before waiting for the
+// active connections to finish. The context passed to Shutdown is
+// forwarded, so handlers can respect its deadline.
+func (server *Server) RegisterOnShutdown(f func(context.Context)) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.shutdownHandlers = append(server.shutdownHandlers, f)
+}
+
+// Shutdown stops accepting new connections, runs all registered shutdown
+// handlers and waits for active connections to finish. If the context
+// expires first, the remaining connections are closed forcefully and
+// the context's error is returned.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.mutex.Lock()
+	if server.shuttingDown {
+		server.mutex.Unlock()
+		return ErrServerClosed
+	}
+	server.shuttingDown = true
+
+	if server.listener != nil {
+		server.listener.Close()
+	}
+	handlers := server.shutdownHandlers
+	server.mutex.Unlock()
+
+	server.Logger.Info("Shutting down ...")
+
+	for _, handler := range handlers {
+		handler(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		server.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		server.Logger.Warning("Shutdown timed out, closing remaining connections")
+		server.closeConnections()
+		return ctx.Err()
+	}
+}
+
+func (server *Server) serve(conn net.Conn) {
+	defer server.handlers.Done()
+	defer server.untrackConnection(conn)
+
+	if server.Limiter != nil {
+		// The limits are checked here instead of the accept loop,
+		// since reading a PROXY header for the address may block
+		addr := conn.RemoteAddr()
+		if err := server.Limiter.Acquire(addr); err != nil {
+			server.reject(conn, err)
+			return
+		}
+		defer server.Limiter.Release(addr)
+	}
+
+	server.requestHandler(conn)
+}
+
+func (server *Server) reject(conn net.Conn, err error) {
+	defer conn.Close()
+	server.Logger.Warningf("Rejected connection from '%s': %v", conn.RemoteAddr(), err)
+
+	if server.RejectHandler == nil {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(RejectTimeout))
+	server.RejectHandler(conn, err)
+
+	// Closing a connection with unread data resets it, which may discard
+	// the reason before the client read it, so let the client close first
+	if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+		closer.CloseWrite()
+		io.Copy(io.Discard, conn)
+	}
+}
+
+func (server *Server) trackConnection(conn net.Conn) bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if server.shuttingDown {
+		return false
+	}
+	server.connections[conn] = struct{}{}
+	server.handlers.Add(1)
+	return true
+}
+
+func (server *Server) untrackConnection(conn net.Conn) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	delete(server.connections, conn)
+}
+
+func (server *Server) closeConnections() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for conn := range server.connections {
+		conn.Close()
 	}
 }
@@ -0,0 +1,96 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Lekuruu/go-chat/internal/logging"
+)
+
+func startServer(t *testing.T, handler func(net.Conn), tlsConfig *tls.Config) (*Server, chan error) {
+	t.Helper()
+
+	server := NewServer("test", "127.0.0.1", 0, handler)
+	server.Logger.SetLevel(logging.QUIET)
+	server.TLSConfig = tlsConfig
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Run() }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not start listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return server, errs
+}
+
+func TestShutdown(t *testing.T) {
+	server, errs := startServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		buf := make([]byte, 1)
+		conn.Read(buf)
+	}, nil)
+
+	notified := make(chan struct{})
+	server.RegisterOnShutdown(func(ctx context.Context) { close(notified) })
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Client disconnects as soon as it's told to
+	go func() {
+		<-notified
+		conn.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-errs; !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Run returned %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	closed := make(chan struct{})
+	server, _ := startServer(t, func(conn net.Conn) {
+		buf := make([]byte, 1)
+		conn.Read(buf)
+		close(closed)
+	}, nil)
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Wait for the connection to be accepted
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Connection was not closed after shutdown timeout")
+	}
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// MemoryTransport connects listeners and dialers inside the same
+// process using net.Pipe, which is mostly useful for tests
+type MemoryTransport struct {
+	listeners map[string]*memoryListener
+	mutex     sync.Mutex
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		listeners: make(map[string]*memoryListener),
+	}
+}
+
+func (transport *MemoryTransport) Listen(address string) (net.Listener, error) {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	if _, exists := transport.listeners[address]; exists {
+		return nil, fmt.Errorf("memory address '%s' is already in use", address)
+	}
+
+	listener := &memoryListener{
+		address:   memoryAddr(address),
+		conns:     make(chan net.Conn),
+		closed:    make(chan struct{}),
+		transport: transport,
+	}
+	transport.listeners[address] = listener
+	return listener, nil
+}
+
+func (transport *MemoryTransport) Dial(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+	transport.mutex.Lock()
+	listener, ok := transport.listeners[address]
+	transport.mutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no memory listener at '%s'", address)
+	}
+
+	server, client := net.Pipe()
+	select {
+	case listener.conns <- server:
+		return client, nil
+	case <-listener.closed:
+		client.Close()
+		server.Close()
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+
+type memoryListener struct {
+	address   memoryAddr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+	transport *MemoryTransport
+}
+
+func (listener *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.conns:
+		return conn, nil
+	case <-listener.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *memoryListener) Close() error {
+	listener.closeOnce.Do(func() {
+		close(listener.closed)
+
+		listener.transport.mutex.Lock()
+		delete(listener.transport.listeners, string(listener.address))
+		listener.transport.mutex.Unlock()
+	})
+	return nil
+}
+
+func (listener *memoryListener) Addr() net.Addr {
+	return listener.address
+}
+
+type memoryAddr string
+
+func (addr memoryAddr) Network() string {
+	return "memory"
+}
+
+func (addr memoryAddr) String() string {
+	return string(addr)
+}
@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// streamTransport uses the operating system's
+// sockets, i.e. tcp or unix domain sockets
+type streamTransport struct {
+	network string
+}
+
+func (transport *streamTransport) Listen(address string) (net.Listener, error) {
+	listener, err := net.Listen(transport.network, address)
+	if err == nil || transport.network != "unix" || !errors.Is(err, syscall.EADDRINUSE) {
+		return listener, err
+	}
+
+	// The socket file may be left over from a server that crashed,
+	// in which case nobody will answer and we can safely replace it
+	if conn, dialErr := net.Dial("unix", address); dialErr == nil {
+		conn.Close()
+		return nil, err
+	}
+	if removeErr := os.Remove(address); removeErr != nil {
+		return nil, err
+	}
+	return net.Listen(transport.network, address)
+}
+
+func (transport *streamTransport) Dial(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	return dialer.DialContext(ctx, transport.network, address)
+}
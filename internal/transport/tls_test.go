@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	certPEM, keyPEM, err := GenerateCertificate([]string{"localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	directory := t.TempDir()
+	certFile := filepath.Join(directory, "cert.pem")
+	keyFile := filepath.Join(directory, "key.pem")
+
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func tlsHandshake(t *testing.T, serverConfig *tls.Config, clientConfig *tls.Config) error {
+	t.Helper()
+
+	// Memory pipes are synchronous, which would deadlock when
+	// the client aborts the handshake while the server is writing
+	endpoint := Endpoint{"unix", filepath.Join(t.TempDir(), "tls.sock")}
+	listener, err := Listen(endpoint)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	listener = tls.NewListener(listener, serverConfig)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, nil, endpoint)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	return tls.Client(conn, clientConfig).HandshakeContext(ctx)
+}
+
+func TestTLSCertificateAuthority(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+
+	serverConfig, err := ServerTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load server config: %v", err)
+	}
+
+	clientConfig, err := ClientTLSConfig("localhost", certFile, "")
+	if err != nil {
+		t.Fatalf("Failed to create client config: %v", err)
+	}
+
+	if err := tlsHandshake(t, serverConfig, clientConfig); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+}
+
+func TestTLSUntrustedCertificate(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+
+	serverConfig, err := ServerTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load server config: %v", err)
+	}
+
+	// Self-signed certificates are not in the system roots
+	clientConfig, err := ClientTLSConfig("localhost", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create client config: %v", err)
+	}
+
+	if err := tlsHandshake(t, serverConfig, clientConfig); err == nil {
+		t.Fatal("Handshake should fail for an untrusted certificate")
+	}
+}
+
+func TestTLSFingerprint(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+
+	serverConfig, err := ServerTLSConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load server config: %v", err)
+	}
+
+	fingerprint := strings.ToUpper(CertificateFingerprint(serverConfig))
+	clientConfig, err := ClientTLSConfig("localhost", "", fingerprint)
+	if err != nil {
+		t.Fatalf("Failed to create client config: %v", err)
+	}
+
+	if err := tlsHandshake(t, serverConfig, clientConfig); err != nil {
+		t.Fatalf("Handshake with pinned fingerprint failed: %v", err)
+	}
+
+	wrongFingerprint := strings.Repeat("00", 32)
+	clientConfig, err = ClientTLSConfig("localhost", "", wrongFingerprint)
+	if err != nil {
+		t.Fatalf("Failed to create client config: %v", err)
+	}
+
+	if err := tlsHandshake(t, serverConfig, clientConfig); err == nil {
+		t.Fatal("Handshake should fail for a mismatching fingerprint")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	if _, err := ParseFingerprint("AB:CD"); err == nil {
+		t.Fatal("Expected error for short fingerprint")
+	}
+
+	colons := strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+	fingerprint, err := ParseFingerprint(colons)
+	if err != nil {
+		t.Fatalf("Failed to parse fingerprint: %v", err)
+	}
+	if fingerprint != strings.Repeat("ab", 32) {
+		t.Fatalf("Unexpected fingerprint %q", fingerprint)
+	}
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Transport creates listeners and connections for one address scheme
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error)
+}
+
+// WrappingTransport is implemented by transports that carry the
+// stream inside another protocol. Listeners passed to wrap see the
+// raw connections, before that protocol is spoken on them.
+type WrappingTransport interface {
+	ListenWrapped(address string, wrap func(net.Listener) net.Listener) (net.Listener, error)
+}
+
+// Endpoint is a parsed URL-style address, e.g. "tcp://localhost:8080",
+// "unix:///run/chat.sock", "ws://localhost:8081/chat" or "memory://test"
+type Endpoint struct {
+	Scheme  string
+	Address string
+}
+
+func (endpoint Endpoint) String() string {
+	return endpoint.Scheme + "://" + endpoint.Address
+}
+
+// Host returns the host name of a network endpoint, without its
+// port or path. It is empty for unix sockets and in-memory pipes.
+func (endpoint Endpoint) Host() string {
+	if endpoint.Scheme != "tcp" && endpoint.Scheme != "ws" {
+		return ""
+	}
+	address, _, _ := strings.Cut(endpoint.Address, "/")
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+var (
+	transports      = make(map[string]Transport)
+	transportsMutex sync.RWMutex
+)
+
+func init() {
+	Register("tcp", &streamTransport{network: "tcp"})
+	Register("unix", &streamTransport{network: "unix"})
+	Register("memory", NewMemoryTransport())
+	Register("ws", &websocketTransport{})
+}
+
+// Register makes a transport available under the given scheme,
+// replacing any transport that was registered before
+func Register(scheme string, transport Transport) {
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+	transports[scheme] = transport
+}
+
+// Lookup returns the transport registered for the given scheme
+func Lookup(scheme string) (Transport, error) {
+	transportsMutex.RLock()
+	defer transportsMutex.RUnlock()
+
+	transport, ok := transports[scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported transport '%s'", scheme)
+	}
+	return transport, nil
+}
+
+// ParseEndpoint parses a URL-style address. Addresses
+// without a scheme are treated as plain tcp addresses.
+func ParseEndpoint(raw string) (Endpoint, error) {
+	scheme, address, found := strings.Cut(raw, "://")
+	if !found {
+		scheme, address = "tcp", raw
+	}
+	if address == "" {
+		return Endpoint{}, fmt.Errorf("missing address in '%s'", raw)
+	}
+	if _, err := Lookup(scheme); err != nil {
+		return Endpoint{}, err
+	}
+	return Endpoint{Scheme: scheme, Address: address}, nil
+}
+
+func Listen(endpoint Endpoint) (net.Listener, error) {
+	transport, err := Lookup(endpoint.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return transport.Listen(endpoint.Address)
+}
+
+// ListenWrapped is like Listen, but wraps the listener of the raw
+// connections, e.g. to read a PROXY protocol header in front of them
+func ListenWrapped(endpoint Endpoint, wrap func(net.Listener) net.Listener) (net.Listener, error) {
+	transport, err := Lookup(endpoint.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	if wrapping, ok := transport.(WrappingTransport); ok {
+		return wrapping.ListenWrapped(endpoint.Address, wrap)
+	}
+
+	listener, err := transport.Listen(endpoint.Address)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(listener), nil
+}
+
+func Dial(ctx context.Context, dialer *net.Dialer, endpoint Endpoint) (net.Conn, error) {
+	transport, err := Lookup(endpoint.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return transport.Dial(ctx, dialer, endpoint.Address)
+}
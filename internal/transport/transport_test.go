@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected Endpoint
+	}{
+		{"localhost:8080", Endpoint{"tcp", "localhost:8080"}},
+		{"tcp://127.0.0.1:8080", Endpoint{"tcp", "127.0.0.1:8080"}},
+		{"unix:///run/chat.sock", Endpoint{"unix", "/run/chat.sock"}},
+		{"memory://test", Endpoint{"memory", "test"}},
+	}
+
+	for _, test := range tests {
+		endpoint, err := ParseEndpoint(test.raw)
+		if err != nil {
+			t.Errorf("ParseEndpoint(%q) failed: %v", test.raw, err)
+			continue
+		}
+		if endpoint != test.expected {
+			t.Errorf("ParseEndpoint(%q) = %v, want %v", test.raw, endpoint, test.expected)
+		}
+	}
+
+	for _, raw := range []string{"unknown://test", "unix://"} {
+		if _, err := ParseEndpoint(raw); err == nil {
+			t.Errorf("ParseEndpoint(%q) should have failed", raw)
+		}
+	}
+}
+
+func TestEndpointHost(t *testing.T) {
+	tests := []struct {
+		endpoint Endpoint
+		expected string
+	}{
+		{Endpoint{"tcp", "chat.example.com:8080"}, "chat.example.com"},
+		{Endpoint{"tcp", "[::1]:8080"}, "::1"},
+		{Endpoint{"ws", "chat.example.com:443/chat"}, "chat.example.com"},
+		{Endpoint{"ws", "chat.example.com/chat"}, "chat.example.com"},
+		{Endpoint{"unix", "/run/chat.sock"}, ""},
+		{Endpoint{"memory", "test"}, ""},
+	}
+
+	for _, test := range tests {
+		if host := test.endpoint.Host(); host != test.expected {
+			t.Errorf("Host(%v) = %q, want %q", test.endpoint, host, test.expected)
+		}
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	testRoundTrip(t, Endpoint{"memory", t.Name()})
+}
+
+func TestUnixTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.sock")
+	testRoundTrip(t, Endpoint{"unix", path})
+}
+
+func testRoundTrip(t *testing.T, endpoint Endpoint) {
+	t.Helper()
+
+	listener, err := Listen(endpoint)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", endpoint, err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, &net.Dialer{}, endpoint)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", endpoint, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	response := make([]byte, 4)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(response) != "ping" {
+		t.Fatalf("Received %q, want %q", response, "ping")
+	}
+}
+
+// countingListener counts the raw connections it accepted
+type countingListener struct {
+	net.Listener
+	accepted chan struct{}
+}
+
+func (listener *countingListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err == nil {
+		listener.accepted <- struct{}{}
+	}
+	return conn, err
+}
+
+func TestListenWrapped(t *testing.T) {
+	accepted := make(chan struct{}, 1)
+	wrap := func(listener net.Listener) net.Listener {
+		return &countingListener{Listener: listener, accepted: accepted}
+	}
+
+	listener, err := ListenWrapped(Endpoint{"ws", "127.0.0.1:0/chat"}, wrap)
+	if err != nil {
+		t.Fatalf("ListenWrapped failed: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// The wrapped listener sees the raw connection before the upgrade
+	conn, err := Dial(ctx, &net.Dialer{}, Endpoint{"ws", listener.Addr().String() + "/chat"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case <-accepted:
+	case <-ctx.Done():
+		t.Fatalf("ListenWrapped failed: the raw connection was not accepted by the wrapper")
+	}
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	response := make([]byte, 4)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/Lekuruu/go-chat/internal/websocket"
+)
+
+// websocketTransport carries the stream inside binary websocket
+// frames, with addresses in the form of "host:port/path"
+type websocketTransport struct{}
+
+func (transport *websocketTransport) Listen(address string) (net.Listener, error) {
+	host, path := splitPath(address)
+	return websocket.Listen("tcp", host, path)
+}
+
+func (transport *websocketTransport) ListenWrapped(address string, wrap func(net.Listener) net.Listener) (net.Listener, error) {
+	host, path := splitPath(address)
+	listener, err := net.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	return websocket.Serve(wrap(listener), path), nil
+}
+
+func (transport *websocketTransport) Dial(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	host, _ := splitPath(address)
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	wsConn, err := websocket.Client(ctx, conn, "ws://"+address)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return wsConn, nil
+}
+
+func splitPath(address string) (string, string) {
+	host, path, _ := strings.Cut(address, "/")
+	return host, "/" + path
+}
@@ -0,0 +1,278 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	OpcodeContinuation uint8 = 0x0
+	OpcodeText         uint8 = 0x1
+	OpcodeBinary       uint8 = 0x2
+	OpcodeClose        uint8 = 0x8
+	OpcodePing         uint8 = 0x9
+	OpcodePong         uint8 = 0xA
+)
+
+const (
+	CloseNormal          uint16 = 1000
+	CloseProtocolError   uint16 = 1002
+	CloseUnsupportedData uint16 = 1003
+)
+
+const maxControlPayloadSize = 125
+
+var ErrProtocol = errors.New("websocket: protocol error")
+
+// Conn is a websocket connection that behaves like a byte stream:
+// every call to Write is sent as a single binary frame, while Read
+// returns the payload of incoming binary frames in order. Control
+// frames are handled transparently.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// Clients have to mask their frames, servers must not
+	isClient bool
+
+	// State of the frame that is currently being read
+	remaining uint64
+	mask      [4]byte
+	masked    bool
+	position  int
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closeSent  bool
+}
+
+func newConn(conn net.Conn, reader *bufio.Reader, isClient bool) *Conn {
+	if reader == nil {
+		reader = bufio.NewReader(conn)
+	}
+	return &Conn{
+		conn:     conn,
+		reader:   reader,
+		isClient: isClient,
+	}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	n, err := c.reader.Read(p)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			p[i] ^= c.mask[(c.position+i)%4]
+		}
+	}
+	c.position += n
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers until a data frame with a non-empty
+// payload is found, answering any control frames along the way
+func (c *Conn) nextFrame() error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		// We don't negotiate any extensions
+		c.closeWithCode(CloseProtocolError)
+		return ErrProtocol
+	}
+	if masked == c.isClient {
+		// Client frames must be masked, server frames must not be
+		c.closeWithCode(CloseProtocolError)
+		return ErrProtocol
+	}
+
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case OpcodeBinary, OpcodeContinuation:
+		c.remaining = length
+		c.mask = mask
+		c.masked = masked
+		c.position = 0
+		return nil
+	case OpcodeText:
+		// ECP is a binary protocol
+		c.closeWithCode(CloseUnsupportedData)
+		return ErrProtocol
+	}
+
+	// Control frames have to fit into a single small frame
+	if length > maxControlPayloadSize || header[0]&0x80 == 0 {
+		c.closeWithCode(CloseProtocolError)
+		return ErrProtocol
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	switch opcode {
+	case OpcodePing:
+		return c.writeFrame(OpcodePong, payload)
+	case OpcodePong:
+		return nil
+	case OpcodeClose:
+		// Echo the status code back & end the stream
+		c.closeWithPayload(payload)
+		return io.EOF
+	default:
+		c.closeWithCode(CloseProtocolError)
+		return ErrProtocol
+	}
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(OpcodeBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Conn) writeFrame(opcode uint8, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == OpcodeClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+
+	var maskBit byte
+	if c.isClient {
+		maskBit = 0x80
+	}
+
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	if !c.isClient {
+		frame = append(frame, payload...)
+		_, err := c.conn.Write(frame)
+		return err
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+
+	offset := len(frame)
+	frame = append(frame, payload...)
+	for i := range payload {
+		frame[offset+i] ^= mask[i%4]
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *Conn) closeWithCode(code uint16) {
+	c.closeWithPayload(binary.BigEndian.AppendUint16(nil, code))
+}
+
+func (c *Conn) closeWithPayload(payload []byte) {
+	if len(payload) > 2 {
+		// Only echo the status code, not the reason
+		payload = payload[:2]
+	}
+	c.writeFrame(OpcodeClose, payload)
+}
+
+// Close sends a close frame, if none was sent yet,
+// and closes the underlying connection
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.closeWithCode(CloseNormal)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
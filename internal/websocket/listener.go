@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Listener accepts websocket connections on an http endpoint,
+// so they can be served like any other stream connection
+type Listener struct {
+	listener net.Listener
+	server   *http.Server
+	conns    chan net.Conn
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// Listen starts an http server on the given address, which
+// upgrades requests to path into websocket connections
+func Listen(network string, address string, path string) (*Listener, error) {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return Serve(listener, path), nil
+}
+
+// Serve starts an http server on an existing listener, which
+// upgrades requests to path into websocket connections
+func Serve(listener net.Listener, path string) *Listener {
+	wsListener := &Listener{
+		listener: listener,
+		conns:    make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, wsListener.handleUpgrade)
+
+	wsListener.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go wsListener.server.Serve(listener)
+	return wsListener
+}
+
+func (l *Listener) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	conn, err := Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting new websocket connections. Connections
+// that were already accepted are not affected.
+func (l *Listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.server.Close()
+	})
+	return err
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
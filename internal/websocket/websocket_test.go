@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func connect(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := Listen("tcp", "127.0.0.1:0", "/chat")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+
+	client, err := Client(ctx, conn, "ws://"+listener.Addr().String()+"/chat")
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	select {
+	case server := <-accepted:
+		t.Cleanup(func() { server.Close() })
+		return client, server
+	case <-ctx.Done():
+		t.Fatal("Server did not accept the connection")
+		return nil, nil
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	client, server := connect(t)
+
+	// Cover all three payload length encodings
+	for _, size := range []int{5, 300, 70000} {
+		payload := bytes.Repeat([]byte{0xAB}, size)
+
+		go client.Write(payload)
+
+		received := make([]byte, size)
+		if _, err := io.ReadFull(server, received); err != nil {
+			t.Fatalf("Failed to read %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(received, payload) {
+			t.Fatalf("Payload of %d bytes was corrupted", size)
+		}
+
+		go server.Write(payload)
+
+		if _, err := io.ReadFull(client, received); err != nil {
+			t.Fatalf("Failed to read %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(received, payload) {
+			t.Fatalf("Payload of %d bytes was corrupted", size)
+		}
+	}
+}
+
+func TestControlFrames(t *testing.T) {
+	client, server := connect(t)
+
+	// Pings should be answered without interrupting the stream
+	if err := client.writeFrame(OpcodePing, []byte("ping")); err != nil {
+		t.Fatalf("Failed to send ping: %v", err)
+	}
+	go client.Write([]byte("data"))
+
+	received := make([]byte, 4)
+	if _, err := io.ReadFull(server, received); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if string(received) != "data" {
+		t.Fatalf("Received %q, want %q", received, "data")
+	}
+
+	// A close frame ends the stream on the other side
+	client.Close()
+	if _, err := server.Read(received); err != io.EOF {
+		t.Fatalf("Read returned %v, want %v", err, io.EOF)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3
+	if key := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("acceptKey returned %q", key)
+	}
+}